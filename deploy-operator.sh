@@ -5,8 +5,13 @@
 oc apply -f ./deploy/role.yaml -n ${PROJECT_NAME}
 oc apply -f ./deploy/service_account.yaml -n ${PROJECT_NAME}
 oc apply -f ./deploy/role_binding.yaml -n ${PROJECT_NAME}
+oc apply -f ./deploy/cluster_role.yaml
+cat ./deploy/cluster_role_binding.yaml | \
+  sed "s/{{\b*PROJECT_NAME\b*}}/${PROJECT_NAME}/" | oc apply -f -
 
 oc apply -f ./deploy/crds/kharon_v1alpha1_canary_crd.yaml -n ${PROJECT_NAME}
+oc apply -f ./deploy/crds/kharon_v1alpha1_metrictemplate_crd.yaml -n ${PROJECT_NAME}
+oc apply -f ./deploy/crds/kharon_v1alpha1_clustermetrictemplate_crd.yaml
 
 cat ./deploy/operator.yaml | \
   sed "s/{{\b*QUAY_USERNAME\b*}}/${QUAY_USERNAME}/" | \
@@ -1,8 +1,7 @@
 package v1alpha1
 
 import (
-	time "time"
-
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	intstr "k8s.io/apimachinery/pkg/util/intstr"
@@ -20,6 +19,23 @@ const (
 	EndCanaryRelease      ActionType = "EndCanaryRelease"
 	RollbackReleaseStart  ActionType = "RollbackReleaseStart"
 	RollbackReleaseEnd    ActionType = "RollbackReleaseEnd"
+	PreviewRelease        ActionType = "PreviewRelease"
+	SwitchRelease         ActionType = "SwitchRelease"
+	ABTestingRelease      ActionType = "ABTestingRelease"
+	MirrorRelease         ActionType = "MirrorRelease"
+	RunHook               ActionType = "RunHook"
+	AwaitApproval         ActionType = "AwaitApproval"
+	AwaitSamples          ActionType = "AwaitSamples"
+	ApproveRelease        ActionType = "ApproveRelease"
+	PauseRelease          ActionType = "PauseRelease"
+	PromoteRelease        ActionType = "PromoteRelease"
+	AbortRelease          ActionType = "AbortRelease"
+	SkipAnalysis          ActionType = "SkipAnalysis"
+	UnknownCommand        ActionType = "UnknownCommand"
+	RollbackToRelease     ActionType = "RollbackToRelease"
+	DetectCanaryRelease   ActionType = "DetectCanaryRelease"
+	AwaitPrimary          ActionType = "AwaitPrimary"
+	RestoreTarget         ActionType = "RestoreTarget"
 	RequeueEvent          ActionType = "RequeueEvent"
 	NoAction              ActionType = "NoAction"
 )
@@ -45,26 +61,317 @@ type Metric struct {
 	Operator        string  `json:"operator"`
 	Interval        int32   `json:"interval"`
 	PrometheusQuery string  `json:"prometheusQuery"`
+	// Bounds of the between and outside operators, Threshold is ignored
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+	// Metric provider (Prometheus, Datadog, InfluxDB, InfluxDBFlux or Graphite), if empty the provider of the template or Prometheus.
+	// PrometheusQuery holds the query in the language of the provider
+	// +kubebuilder:validation:Enum=Prometheus,Datadog,InfluxDB,InfluxDBFlux,Graphite
+	Provider MetricProviderType `json:"provider,omitempty"`
+	// Address of the metrics server, if empty the address of the template or CanaryAnalysis.MetricsServer
+	Address string `json:"address,omitempty"`
+	// Max number of failed checks of this metric before rollback, if 0 CanaryAnalysis.Threshold
+	FailureBudget int32 `json:"failureBudget,omitempty"`
+	// Reference to a MetricTemplate or ClusterMetricTemplate, if set PrometheusQuery is ignored. The Canary is not valid
+	// while the template is missing, and a check fails if the template is gone or leaves the metric without a valid operator
+	TemplateRef *MetricTemplateRef `json:"templateRef,omitempty"`
+	// Arguments of the query template, available as .Args
+	TemplateArgs map[string]string `json:"templateArgs,omitempty"`
+	// Seconds of samples the query runs over (range query), if 0 it's an instant query
+	Window int32 `json:"window,omitempty"`
+	// Seconds between samples of a range query, if 0 15
+	Step int32 `json:"step,omitempty"`
+	// How samples are reduced to one value, avg, max, min, last or a percentile like p99, if empty last
+	Reducer string `json:"reducer,omitempty"`
+	// What to do if the query returns more than one series, Error, First or Merge (samples of every series are reduced together), if empty Error
+	// +kubebuilder:validation:Enum=Error,First,Merge
+	MultiSeries MultiSeriesPolicy `json:"multiSeries,omitempty"`
+	// If set the query runs for primary and canary and their samples are compared, Operator and Threshold are ignored
+	Baseline *BaselineSpec `json:"baseline,omitempty"`
+	// What the check does if the query fails or returns no data or NaN, fail, pass, skip (the check doesn't count
+	// and the canary holds its step) or retry (the check doesn't count and the query runs again on the next requeue,
+	// up to NoDataRetries times, then the check fails), if empty fail
+	// +kubebuilder:validation:Enum=fail,pass,skip,retry
+	NoDataPolicy NoDataPolicy `json:"noDataPolicy,omitempty"`
+	// Requeues the query is retried with the retry NoDataPolicy, if 0 2
+	NoDataRetries int32 `json:"noDataRetries,omitempty"`
+	// Samples the query must return for the check to count, with a Baseline both canary and baseline, if 0 1.
+	// The canary holds its step until there are
+	MinSamples int32 `json:"minSamples,omitempty"`
+	// Query of the requests served by the canary, rendered and run like the query of the metric, the check doesn't
+	// count and the canary holds its step until its value reaches MinRequestCount
+	RequestCountQuery string  `json:"requestCountQuery,omitempty"`
+	MinRequestCount   float64 `json:"minRequestCount,omitempty"`
+}
+
+// NoDataPolicy defines what a metric check does when its query fails or returns no data
+type NoDataPolicy string
+
+const (
+	NoDataFail  NoDataPolicy = "fail"
+	NoDataPass  NoDataPolicy = "pass"
+	NoDataSkip  NoDataPolicy = "skip"
+	NoDataRetry NoDataPolicy = "retry"
+)
+
+// MultiSeriesPolicy defines what to do when a metric query returns more than one series
+type MultiSeriesPolicy string
+
+const (
+	MultiSeriesError MultiSeriesPolicy = "Error"
+	MultiSeriesFirst MultiSeriesPolicy = "First"
+	MultiSeriesMerge MultiSeriesPolicy = "Merge"
+)
+
+// BaselineDirection defines in which direction a metric of the canary is worse than the baseline
+type BaselineDirection string
+
+const (
+	BaselineDirectionHigher BaselineDirection = "Higher"
+	BaselineDirectionLower  BaselineDirection = "Lower"
+)
+
+// BaselineSpec defines how a metric of the canary is compared with the same metric of the primary release (the baseline).
+// The query runs twice, the second time with .Spec.TargetRef pointing to the primary release, and a Mann-Whitney U
+// test tells if canary samples are significantly worse than baseline samples
+type BaselineSpec struct {
+	// Seconds of samples compared, if 0 CanaryAnalysis.Interval
+	Window int32 `json:"window,omitempty"`
+	// Seconds between samples, if 0 15
+	Step int32 `json:"step,omitempty"`
+	// Confidence needed to call the canary worse, between 0 and 1, if 0 0.95
+	Confidence float64 `json:"confidence,omitempty"`
+	// Direction in which the canary is worse, Higher (error rate, latency...) or Lower (throughput...), if empty Higher
+	// +kubebuilder:validation:Enum=Higher,Lower
+	Worse BaselineDirection `json:"worse,omitempty"`
+}
+
+// MetricsPolicy defines how the checks of several metrics are combined
+type MetricsPolicy string
+
+const (
+	// Rollback as soon as any metric runs out of failure budget
+	MetricsPolicyAll MetricsPolicy = "All"
+	// Rollback only when every metric has run out of failure budget
+	MetricsPolicyAny MetricsPolicy = "Any"
+)
+
+// CanaryStep defines a weight of the canary schedule and, optionally, how long it holds
+type CanaryStep struct {
+	Weight   int32 `json:"weight"`
+	Interval int32 `json:"interval,omitempty"` // In seconds, if 0 CanaryAnalysis.Interval
 }
 
 // CanaryAnalisys defines how to run analysis on a canary release
 type CanaryAnalysis struct {
 	MetricsServer string `json:"metricsServer"`
-	Interval      int32  `json:"interval"` // In seconds
-	Threshold     int32  `json:"threshold"`
-	MaxWeight     int32  `json:"maxWeight"`
-	StepWeight    int32  `json:"stepWeight"`
-	Metric        Metric `json:"metric"`
+	// Name of a Secret with the credentials to access the metrics server, keys token (bearer token), username
+	// and password (basic auth), tls.crt and tls.key (client certificate) and ca.crt (CA bundle), all optional
+	MetricsServerSecret string `json:"metricsServerSecret,omitempty"`
+	// Seconds before a query to the metrics server is cancelled, if 0 10
+	MetricsServerTimeout int32 `json:"metricsServerTimeout,omitempty"`
+	Interval             int32 `json:"interval"` // In seconds
+	Threshold            int32 `json:"threshold"`
+	MaxWeight            int32 `json:"maxWeight"`
+	StepWeight           int32 `json:"stepWeight"`
+	// Explicit schedule of increasing weights, if not empty MaxWeight and StepWeight are ignored
+	Steps []CanaryStep `json:"steps,omitempty"`
+	// Single metric, ignored if Metrics is not empty
+	Metric Metric `json:"metric"`
+	// Metrics checked together, each with its own operator, threshold and failure budget
+	Metrics []Metric `json:"metrics,omitempty"`
+	// How metric checks are combined, All (every metric must pass) or Any (one passing metric is enough), if empty All
+	// +kubebuilder:validation:Enum=All,Any
+	MetricsPolicy MetricsPolicy `json:"metricsPolicy,omitempty"`
+	// External checks called at each analysis iteration, they count as metrics for MetricsPolicy
+	Webhooks []WebhookCheck `json:"webhooks,omitempty"`
+	// HTTP load generated against the canary at each step so that metrics have enough samples
+	LoadTest *LoadTestSpec `json:"loadTest,omitempty"`
+}
+
+// LoadTestMode defines how load is generated against the canary
+type LoadTestMode string
+
+const (
+	LoadTestJob       LoadTestMode = "Job"
+	LoadTestInProcess LoadTestMode = "InProcess"
+)
+
+// LoadTestSpec defines the HTTP load generated against the canary Service at each step (each preview iteration for
+// BlueGreen, each iteration for ABTesting), the load of the previous step is stopped when a step starts and the
+// canary ends or is rolled back
+type LoadTestSpec struct {
+	// Job (requests sent by a Job owned by the Canary) or InProcess (requests sent by the operator), if empty Job.
+	// InProcess load stops if the operator restarts, then it's resumed for what's left of the step
+	// +kubebuilder:validation:Enum=Job,InProcess
+	Mode LoadTestMode `json:"mode,omitempty"`
+	// HTTP method, if empty GET
+	Method string `json:"method,omitempty"`
+	// Path requested to the canary Service, if empty /
+	Path string `json:"path,omitempty"`
+	// Requests per second, at most 1000, if 0 10
+	RequestsPerSecond int32 `json:"requestsPerSecond,omitempty"`
+	// Seconds the load lasts at each step, if 0 the interval between steps
+	Duration int32 `json:"duration,omitempty"`
+	// Image of the Job, it needs sh and curl, if empty ubi-minimal
+	Image string `json:"image,omitempty"`
+}
+
+// WebhookCheck defines an external check, at each analysis iteration the canary is POSTed to URL and the check
+// fails if the response is not 2xx, its body is {"pass": false} or the webhook can't be reached
+type WebhookCheck struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Seconds before the call is cancelled, if 0 10
+	Timeout int32 `json:"timeout,omitempty"`
+	// Extra fields sent to the webhook in metadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Max number of failed checks of this webhook before rollback, if 0 CanaryAnalysis.Threshold
+	FailureBudget int32 `json:"failureBudget,omitempty"`
 }
 
 // CanaryType defines the potential condition types
 type CanaryType string
 
 const (
-	Native CanaryType = "Native"
-	Istio  CanaryType = "Istio"
+	Native       CanaryType = "Native"
+	Istio        CanaryType = "Istio"
+	GatewayAPI   CanaryType = "GatewayAPI"
+	NginxIngress CanaryType = "NginxIngress"
+	SMI          CanaryType = "SMI"
+	ReplicaRatio CanaryType = "ReplicaRatio"
 )
 
+// StrategyType defines the potential deployment strategies
+type StrategyType string
+
+const (
+	CanaryStrategy    StrategyType = "Canary"
+	BlueGreenStrategy StrategyType = "BlueGreen"
+	ABTestingStrategy StrategyType = "ABTesting"
+)
+
+// BlueGreenSpec defines how a blue/green release is analysed and switched
+type BlueGreenSpec struct {
+	// Number of analysis iterations run against the preview before switching traffic, at least 1
+	Iterations int32 `json:"iterations"`
+	// Seconds the previous release is kept warm after switching, analysis goes on and a failure switches back
+	RollbackWindow int32 `json:"rollbackWindow"`
+}
+
+// MirrorSpec defines the optional phase where traffic is mirrored to the canary before shifting any weight
+type MirrorSpec struct {
+	// Number of analysis iterations with traffic mirrored to the canary, if 0 there's no mirroring phase
+	Iterations int32 `json:"iterations"`
+}
+
+// ApprovalSpec defines the points of a canary release that need manual approval, a release is approved by
+// annotating the Canary with kharon.redhat.com/approve=true
+type ApprovalSpec struct {
+	// Weights the canary doesn't go past without approval, e.g. with 50 the canary holds at the step before going above 50%
+	Weights []int32 `json:"weights,omitempty"`
+	// If true the canary is not promoted (the release doesn't end) without approval
+	Promotion bool `json:"promotion,omitempty"`
+}
+
+// HookType defines the points of a canary release where hooks run
+type HookType string
+
+const (
+	PreRolloutHook    HookType = "preRollout"
+	RolloutHook       HookType = "rollout"
+	PrePromotionHook  HookType = "prePromotion"
+	PostPromotionHook HookType = "postPromotion"
+	OnRollbackHook    HookType = "onRollback"
+)
+
+// Hook defines a Job or an HTTP call run at some point of a canary release, either Job or URL must be set
+type Hook struct {
+	Name string `json:"name"`
+	// Job run to completion, the hook fails if the Job fails, if RestartPolicy is empty Never
+	Job *batchv1.JobSpec `json:"job,omitempty"`
+	// URL POSTed the state of the canary, the hook fails if the response is not 2xx
+	URL string `json:"url,omitempty"`
+	// Seconds before the HTTP call is cancelled, if 0 10
+	Timeout int32 `json:"timeout,omitempty"`
+}
+
+// HooksSpec defines the hooks of a canary release, they run in order. Kharon waits for preRollout (before the first
+// step), rollout (before every step) and prePromotion (before the release ends) hooks to succeed and rolls back if
+// any fails, postPromotion (after the release ends) and onRollback hooks are started and not waited for
+type HooksSpec struct {
+	PreRollout    []Hook `json:"preRollout,omitempty"`
+	Rollout       []Hook `json:"rollout,omitempty"`
+	PrePromotion  []Hook `json:"prePromotion,omitempty"`
+	PostPromotion []Hook `json:"postPromotion,omitempty"`
+	OnRollback    []Hook `json:"onRollback,omitempty"`
+}
+
+// HeaderMatch defines a condition on an HTTP header
+type HeaderMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// If true Value is a regular expression, otherwise it has to match exactly
+	Regex bool `json:"regex,omitempty"`
+}
+
+// CookieMatch defines a condition on a cookie, it has to be present with the exact value
+type CookieMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// MatchRule defines which requests are sent to the canary, all its conditions have to be met
+type MatchRule struct {
+	Headers []HeaderMatch `json:"headers,omitempty"`
+	Cookies []CookieMatch `json:"cookies,omitempty"`
+}
+
+// ABTestingSpec defines which requests are sent to the canary during an A/B test and for how long
+type ABTestingSpec struct {
+	// Number of analysis iterations before promoting the canary, at least 1
+	Iterations int32 `json:"iterations"`
+	// Requests matching any of these rules are sent to the canary
+	Match []MatchRule `json:"match"`
+}
+
+// IstioSpec defines how the VirtualService for an Istio canary is exposed
+type IstioSpec struct {
+	// Hosts of the VirtualService, if empty ServiceName is used
+	Hosts []string `json:"hosts,omitempty"`
+	// Gateways the VirtualService is bound to, if empty it applies to the mesh only
+	Gateways []string `json:"gateways,omitempty"`
+}
+
+// ParentRef defines a pointer to a Gateway an HTTPRoute attaches to
+type ParentRef struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace,omitempty"`
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// GatewayAPISpec defines how the HTTPRoute for a GatewayAPI canary is exposed
+type GatewayAPISpec struct {
+	// Gateways the HTTPRoute attaches to
+	ParentRefs []ParentRef `json:"parentRefs,omitempty"`
+	// Hostnames of the HTTPRoute, if empty it matches any hostname of the Gateway
+	Hostnames []string `json:"hostnames,omitempty"`
+}
+
+// NginxIngressSpec defines which Ingress is cloned into the canary Ingress for a NginxIngress canary
+type NginxIngressSpec struct {
+	// Name of the primary Ingress, if empty ServiceName is used
+	IngressName string `json:"ingressName,omitempty"`
+}
+
+// ReplicaRatioSpec defines how traffic is split scaling primary and canary for a ReplicaRatio canary
+type ReplicaRatioSpec struct {
+	// Total number of replicas shared by primary and canary, at least 2 as each keeps one until the canary is promoted
+	Replicas int32 `json:"replicas"`
+	// Selector of the Service named ServiceName, it must match the pods of every release
+	Selector map[string]string `json:"selector"`
+}
+
 // CanarySpec defines the desired state of Canary
 // +k8s:openapi-gen=true
 type CanarySpec struct {
@@ -72,13 +379,17 @@ type CanarySpec struct {
 	Enabled bool `json:"enabled"`
 	// Flags if Canary has been initialized or not
 	Initialized bool `json:"initialized"`
-	// Two types of Canary releases, Native or Istio
-	// +kubebuilder:validation:Enum=Native,Istio
+	// Type of Canary releases, Native (OpenShift Route), Istio, GatewayAPI, NginxIngress, SMI (TrafficSplit) or ReplicaRatio
+	// +kubebuilder:validation:Enum=Native,Istio,GatewayAPI,NginxIngress,SMI,ReplicaRatio
 	Type CanaryType `json:"type"`
 	// Name of the primary service, will be used to create a Service and Route or VirtualService
 	ServiceName string `json:"serviceName"`
 	// Reference to the Deployment or DeploymentConfig from which to generate the Canary release
 	TargetRef Ref `json:"targetRef"`
+	// If true TargetRef (a Deployment) is watched, each new pod template becomes a canary and is promoted to a managed <name>-primary Deployment.
+	// Traffic only moves to the primary, and TargetRef is only scaled down, once the primary rolled out. If the Canary is deleted,
+	// TargetRef is scaled back up and gets the traffic back before the primary is deleted
+	AutoDetect bool `json:"autoDetect,omitempty"`
 	// Selector, if empty take the labels of the template of the Target Deployment
 	TargetRefSelector map[string]string `json:"targetRefSelector"`
 	// Name of the container in the Deployment, if empty take the first one
@@ -87,10 +398,43 @@ type CanarySpec struct {
 	TargetRefContainerPort intstr.IntOrString `json:"targetRefContainerPort"`
 	// Protocol of container in the Deployment, if empty take the first one
 	TargetRefContainerProtocol corev1.Protocol `json:"targetRefContainerProtocol"`
+	// Deployment strategy, Canary (incremental weights), BlueGreen (instant switch) or ABTesting (header/cookie matches), if empty Canary
+	// +kubebuilder:validation:Enum=Canary,BlueGreen,ABTesting
+	Strategy StrategyType `json:"strategy,omitempty"`
 	// Canary Analisys Settings
 	CanaryAnalysis CanaryAnalysis `json:"canaryAnalysis"`
+	// Mirroring settings, only used if Strategy is Canary and Type is Istio or GatewayAPI
+	Mirror MirrorSpec `json:"mirror,omitempty"`
+	// Lifecycle hooks, the Canary is not valid with hooks unless Strategy is Canary
+	Hooks HooksSpec `json:"hooks,omitempty"`
+	// Manual approval gates, the Canary is not valid with gates unless Strategy is Canary
+	Approval ApprovalSpec `json:"approval,omitempty"`
+	// If true the release holds at the current step, analysis goes on
+	Paused bool `json:"paused,omitempty"`
+	// Blue/green settings, only used if Strategy is BlueGreen
+	BlueGreen BlueGreenSpec `json:"blueGreen,omitempty"`
+	// A/B testing settings, only used if Strategy is ABTesting
+	ABTesting ABTestingSpec `json:"abTesting,omitempty"`
+	// Istio settings, only used if Type is Istio
+	Istio IstioSpec `json:"istio,omitempty"`
+	// Gateway API settings, only used if Type is GatewayAPI
+	GatewayAPI GatewayAPISpec `json:"gatewayAPI,omitempty"`
+	// NGINX Ingress settings, only used if Type is NginxIngress
+	NginxIngress NginxIngressSpec `json:"nginxIngress,omitempty"`
+	// Replica ratio settings, only used if Type is ReplicaRatio
+	ReplicaRatio ReplicaRatioSpec `json:"replicaRatio,omitempty"`
 }
 
+// CanaryPhase defines the potential phases of a running canary
+type CanaryPhase string
+
+const (
+	CanaryPhaseProgressing      CanaryPhase = "Progressing"
+	CanaryPhasePaused           CanaryPhase = "Paused"
+	CanaryPhaseAwaitingApproval CanaryPhase = "AwaitingApproval"
+	CanaryPhaseFailed           CanaryPhase = "Failed" // Only used if AutoDetect, kept until the pod template changes
+)
+
 // CanaryConditionType defines the potential condition types
 type CanaryConditionType string
 
@@ -147,22 +491,55 @@ type ReconcileStatus struct {
 	Reason     string                `json:"reason,omitempty"`
 }
 
+// MetricStatus defines the last value of a metric of the current canary and how many times it failed
+type MetricStatus struct {
+	Name         string  `json:"name"`
+	Value        float64 `json:"value"` // Median of the canary samples if compared with the baseline
+	FailedChecks int32   `json:"failedChecks"`
+	// Consecutive checks without data retried with the retry NoDataPolicy
+	NoDataRetries int32 `json:"noDataRetries,omitempty"`
+	// Only if compared with the baseline, median of the baseline samples and p-value of the canary being worse
+	BaselineValue float64 `json:"baselineValue,omitempty"`
+	PValue        float64 `json:"pValue,omitempty"`
+}
+
+// HookStatus defines a hook of the current canary that has started, Iteration is the step of rollout hooks
+type HookStatus struct {
+	Name      string   `json:"name"`
+	Type      HookType `json:"type"`
+	Iteration int32    `json:"iteration"`
+	Succeeded bool     `json:"succeeded"`
+}
+
+// WebhookStatus defines how many times a webhook check of the current canary failed
+type WebhookStatus struct {
+	Name         string `json:"name"`
+	FailedChecks int32  `json:"failedChecks"`
+}
+
 // CanaryStatus defines the observed state of Canary
 // +k8s:openapi-gen=true
 type CanaryStatus struct {
 	ReconcileStatus `json:",inline"`
 
-	IsCanaryRunning   bool              `json:"isCanaryRunning"`
-	CanaryWeight      int32             `json:"canaryWeight"`
-	CanaryMetricValue float64           `json:"canaryMetricValue"`
-	FailedChecks      int32             `json:"failedChecks"`
-	Iterations        int32             `json:"iterations"`
-	LastAppliedSpec   time.Duration     `json:"lastAppliedSpec"`
-	LastPromotedSpec  time.Duration     `json:"lastPromotedSpec"`
-	LastStepTime      metav1.Time       `json:"lastStepTime"`
-	LastAction        ActionType        `json:"lastAction"`
-	Conditions        []CanaryCondition `json:"conditions,omitempty"`     // Used to wait => kubectl wait canary/podinfo --for=condition=promoted
-	ReleaseHistory    []Release         `json:"releaseHistory,omitempty"` // Fed by the carany release process
+	IsCanaryRunning  bool              `json:"isCanaryRunning"`
+	CanaryWeight     int32             `json:"canaryWeight"`
+	Metrics          []MetricStatus    `json:"metrics,omitempty"` // Last value of each metric of the current canary
+	Webhooks         []WebhookStatus   `json:"webhooks,omitempty"`
+	Hooks            []HookStatus      `json:"hooks,omitempty"`
+	Phase            CanaryPhase       `json:"phase,omitempty"`        // Empty if no canary is running
+	Approvals        []string          `json:"approvals,omitempty"`    // Gates of the current canary approved, weight-N or promotion
+	SkipAnalysis     bool              `json:"skipAnalysis,omitempty"` // If true the current canary progresses on the timer alone
+	Promoted         bool              `json:"promoted,omitempty"`     // If true the current canary was promoted by command and ends as soon as it can
+	FailedChecks     int32             `json:"failedChecks"`
+	Iterations       int32             `json:"iterations"`
+	MirrorIterations int32             `json:"mirrorIterations"`
+	LastAppliedSpec  string            `json:"lastAppliedSpec"`  // Hash of the last pod template of TargetRef released, only used if AutoDetect
+	LastPromotedSpec string            `json:"lastPromotedSpec"` // Hash of the pod template running in the primary, only used if AutoDetect
+	LastStepTime     metav1.Time       `json:"lastStepTime"`
+	LastAction       ActionType        `json:"lastAction"`
+	Conditions       []CanaryCondition `json:"conditions,omitempty"`     // Used to wait => kubectl wait canary/podinfo --for=condition=promoted
+	ReleaseHistory   []Release         `json:"releaseHistory,omitempty"` // Fed by the carany release process
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
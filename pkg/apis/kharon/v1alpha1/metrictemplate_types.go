@@ -0,0 +1,97 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MetricProviderType defines the potential metric providers
+type MetricProviderType string
+
+const (
+	PrometheusProvider   MetricProviderType = "Prometheus"
+	DatadogProvider      MetricProviderType = "Datadog"
+	InfluxDBProvider     MetricProviderType = "InfluxDB"
+	InfluxDBFluxProvider MetricProviderType = "InfluxDBFlux"
+	GraphiteProvider     MetricProviderType = "Graphite"
+)
+
+// MetricTemplateKind defines the kinds of template a metric can reference
+type MetricTemplateKind string
+
+const (
+	MetricTemplateKindNamespaced MetricTemplateKind = "MetricTemplate"
+	MetricTemplateKindCluster    MetricTemplateKind = "ClusterMetricTemplate"
+)
+
+// MetricTemplateRef defines a pointer to a MetricTemplate or ClusterMetricTemplate
+type MetricTemplateRef struct {
+	Name string `json:"name"`
+	// Kind of template, MetricTemplate (in the namespace of the Canary) or ClusterMetricTemplate, if empty MetricTemplate
+	// +kubebuilder:validation:Enum=MetricTemplate,ClusterMetricTemplate
+	Kind MetricTemplateKind `json:"kind,omitempty"`
+}
+
+// MetricTemplateSpec defines the desired state of MetricTemplate and ClusterMetricTemplate
+// +k8s:openapi-gen=true
+type MetricTemplateSpec struct {
+	// Metric provider, if empty Prometheus
+	// +kubebuilder:validation:Enum=Prometheus,Datadog,InfluxDB,InfluxDBFlux,Graphite
+	Provider MetricProviderType `json:"provider,omitempty"`
+	// Address of the metrics server, if empty CanaryAnalysis.MetricsServer
+	Address string `json:"address,omitempty"`
+	// Go template of the query, rendered over the Canary object with the metric arguments in .Args
+	Query string `json:"query"`
+	// Default threshold, used if the metric referencing the template has no Operator
+	Threshold float64 `json:"threshold,omitempty"`
+	// Default operator, used if the metric referencing the template has no Operator
+	Operator string `json:"operator,omitempty"`
+	// Default bounds of the between and outside operators, used if the metric referencing the template has no Operator
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MetricTemplate is the Schema for the metrictemplates API
+// +k8s:openapi-gen=true
+type MetricTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MetricTemplateSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MetricTemplateList contains a list of MetricTemplate
+type MetricTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MetricTemplate `json:"items"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterMetricTemplate is the Schema for the clustermetrictemplates API, a MetricTemplate available to every namespace
+// +k8s:openapi-gen=true
+// +genclient:nonNamespaced
+type ClusterMetricTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MetricTemplateSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterMetricTemplateList contains a list of ClusterMetricTemplate
+type ClusterMetricTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterMetricTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MetricTemplate{}, &MetricTemplateList{})
+	SchemeBuilder.Register(&ClusterMetricTemplate{}, &ClusterMetricTemplateList{})
+}
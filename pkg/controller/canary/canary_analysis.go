@@ -0,0 +1,457 @@
+package canary
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+	_metrics "github.com/redhat/kharon-operator/pkg/util/metrics"
+	_webhooks "github.com/redhat/kharon-operator/pkg/util/webhooks"
+)
+
+// Keys of the Secret with the credentials to access the metrics server, besides the standard basic auth and TLS ones
+const (
+	secretKeyToken  = "token"
+	secretKeyCA     = "ca.crt"
+	secretKeyAPIKey = "apiKey"
+	secretKeyAppKey = "appKey"
+)
+
+const (
+	defaultBaselineStep       = 15 * time.Second
+	defaultBaselineConfidence = 0.95
+	defaultNoDataRetries      = 2
+	defaultMetricsInterval    = 30 * time.Second
+)
+
+// AnalyseCanaryRelease runs the query of every metric and calls every webhook of the canary, updates their status
+// and returns false if, according to MetricsPolicy, the canary has run out of failure budget and has to be rolled back.
+// It returns false as second value if a metric check didn't count, for lack of samples or data, so that the canary
+// holds its step until every check counts
+func (r *ReconcileCanary) AnalyseCanaryRelease(instance *kharonv1alpha1.Canary) (bool, bool) {
+	metrics := _metrics.GetMetrics(instance)
+	// Without a client metrics can't be checked, their checks fail rather than letting the canary through unchecked
+	metricsClient, err := r.NewMetricsClientForCanary(instance)
+	if err != nil {
+		log.Error(err, errorMetricsServerCredentials)
+	} else {
+		defer metricsClient.Close()
+	}
+	failedMetrics := 0
+	exhaustedMetrics := 0
+	uncountedMetrics := 0
+	for i := range metrics {
+		metric := &metrics[i]
+		metricStatus := getMetricStatus(instance, metric.Name)
+		passed, counted := false, true
+		if metricsClient != nil {
+			passed, counted = r.RunMetricCheck(metricsClient, instance, metric, metricStatus)
+		}
+		// If Canary metric is not met, increase failedCheck counter
+		if !counted {
+			uncountedMetrics++
+		} else if !passed {
+			metricStatus.FailedChecks++
+			failedMetrics++
+		}
+
+		if metricStatus.FailedChecks > getFailureBudget(instance, metric.FailureBudget) {
+			exhaustedMetrics++
+		}
+	}
+	for i := range instance.Spec.CanaryAnalysis.Webhooks {
+		webhook := &instance.Spec.CanaryAnalysis.Webhooks[i]
+		webhookStatus := getWebhookStatus(instance, webhook.Name)
+		// Webhooks that can't be reached count as failed, a quality gate is not passed unless it says so
+		if passed, err := r.CheckWebhook(instance, webhook); !passed {
+			if err != nil {
+				log.Error(err, errorWebhookCheckFailed, "Webhook.Name", webhook.Name)
+			}
+			webhookStatus.FailedChecks++
+			failedMetrics++
+		}
+
+		if webhookStatus.FailedChecks > getFailureBudget(instance, webhook.FailureBudget) {
+			exhaustedMetrics++
+		}
+	}
+
+	checks := len(metrics) + len(instance.Spec.CanaryAnalysis.Webhooks)
+	if instance.Spec.CanaryAnalysis.MetricsPolicy == kharonv1alpha1.MetricsPolicyAny {
+		// Only the checks that counted are evaluated, the canary fails the iteration if every one of them failed
+		if evaluated := checks - uncountedMetrics; evaluated > 0 && failedMetrics >= evaluated {
+			instance.Status.FailedChecks++
+		}
+		return exhaustedMetrics < checks, uncountedMetrics <= 0
+	}
+
+	if failedMetrics > 0 {
+		instance.Status.FailedChecks++
+	}
+	return exhaustedMetrics <= 0, uncountedMetrics <= 0
+}
+
+// RunMetricCheck checks a metric applying its NoDataPolicy if the query fails or returns no data, it returns
+// if the canary passed the check and if the check counts
+func (r *ReconcileCanary) RunMetricCheck(metricsClient *_metrics.MetricsClient, instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric, metricStatus *kharonv1alpha1.MetricStatus) (bool, bool) {
+	// A missing template or an invalid operator is a broken metric, not a lack of data, so the check fails
+	metricTemplate, err := r.FetchMetricTemplate(instance, metric.TemplateRef)
+	if err != nil {
+		log.Error(err, errorMetricTemplateNotFound, "Metric.Name", metric.Name)
+		return false, true
+	}
+	if !isValidMetricTemplate(metric, metricTemplate) {
+		log.Error(_util.NewError(errorMetricOperatorNotValid), errorMetricOperatorNotValid, "Metric.Name", metric.Name)
+		return false, true
+	}
+
+	passed, err := r.CheckMetric(metricsClient, instance, metric, metricTemplate, metricStatus)
+	if err == nil {
+		metricStatus.NoDataRetries = 0
+		return passed, true
+	}
+	// Not enough samples yet is not a lack of data, the check just doesn't count until there are
+	if err == _metrics.ErrNotEnoughSamples {
+		log.Info("Not enough samples to check metric", "Metric.Name", metric.Name)
+		return false, false
+	}
+	// With the retry policy the check doesn't count and the query runs again on the next requeue, the canary holds
+	// its step meanwhile
+	if metric.NoDataPolicy == kharonv1alpha1.NoDataRetry && metricStatus.NoDataRetries < getNoDataRetries(metric) {
+		metricStatus.NoDataRetries++
+		log.Info("No data to check metric, retrying on the next requeue", "Metric.Name", metric.Name, "Retry", metricStatus.NoDataRetries)
+		return false, false
+	}
+	metricStatus.NoDataRetries = 0
+	log.Error(err, errorMetricNoData, "Metric.Name", metric.Name, "NoDataPolicy", metric.NoDataPolicy)
+
+	switch metric.NoDataPolicy {
+	case kharonv1alpha1.NoDataPass:
+		return true, true
+	case kharonv1alpha1.NoDataSkip:
+		return false, false
+	default:
+		return false, true
+	}
+}
+
+// CheckMetric runs the query of a metric, updates its status and returns if the canary passed the check
+func (r *ReconcileCanary) CheckMetric(metricsClient *_metrics.MetricsClient, instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric,
+	metricTemplate *kharonv1alpha1.MetricTemplateSpec, metricStatus *kharonv1alpha1.MetricStatus) (bool, error) {
+	// The check waits for the canary to serve enough requests
+	if len(metric.RequestCountQuery) > 0 {
+		requestCount, err := _metrics.ExecuteRequestCountQuery(context.TODO(), metricsClient, instance, metric, metricTemplate)
+		if err != nil {
+			return false, err
+		}
+		if requestCount < metric.MinRequestCount {
+			return false, _metrics.ErrNotEnoughSamples
+		}
+	}
+
+	if metric.Baseline != nil {
+		return r.CompareMetricWithBaseline(metricsClient, instance, metric, metricTemplate, metricStatus)
+	}
+
+	metricValue, err := _metrics.ExecuteMetricQuery(context.TODO(), metricsClient, instance, metric, metricTemplate)
+	if err != nil {
+		return false, err
+	}
+	currentCanaryMetricValue.WithLabelValues(instance.Namespace, instance.Name, instance.Spec.TargetRef.Name, metric.Name).Set(metricValue)
+	metricStatus.Value = metricValue
+	comparison := _metrics.GetMetricComparison(metric, metricTemplate)
+
+	// Relative operators compare with the same query for the primary release
+	baselineValue := 0.0
+	if _metrics.IsRelativeOperator(comparison.Operator) {
+		baseline, err := getBaselineCanary(instance)
+		if err != nil {
+			return false, err
+		}
+		if baselineValue, err = _metrics.ExecuteMetricQuery(context.TODO(), metricsClient, baseline, metric, metricTemplate); err != nil {
+			return false, err
+		}
+		metricStatus.BaselineValue = baselineValue
+	}
+
+	return _metrics.ValidateMetricComparison(metricValue, baselineValue, comparison), nil
+}
+
+// CheckWebhook POSTs the state of the canary to a webhook and returns if the canary passed the check
+func (r *ReconcileCanary) CheckWebhook(instance *kharonv1alpha1.Canary, webhook *kharonv1alpha1.WebhookCheck) (bool, error) {
+	payload := &_webhooks.Payload{
+		Name:      instance.Name,
+		Namespace: instance.Namespace,
+		Target:    instance.Spec.TargetRef.Name,
+		Weight:    instance.Status.CanaryWeight,
+		Iteration: instance.Status.Iterations,
+		Metadata:  webhook.Metadata,
+	}
+
+	return _webhooks.RunWebhookCheck(context.TODO(), webhook.URL, time.Duration(webhook.Timeout)*time.Second, payload)
+}
+
+// CompareMetricWithBaseline runs the range query of a metric for canary and primary, updates its status and returns
+// false if canary samples are significantly worse than primary samples
+func (r *ReconcileCanary) CompareMetricWithBaseline(metricsClient *_metrics.MetricsClient,
+	instance *kharonv1alpha1.Canary,
+	metric *kharonv1alpha1.Metric,
+	metricTemplate *kharonv1alpha1.MetricTemplateSpec,
+	metricStatus *kharonv1alpha1.MetricStatus) (bool, error) {
+	window := time.Duration(metric.Baseline.Window) * time.Second
+	if window <= 0 {
+		window = time.Duration(instance.Spec.CanaryAnalysis.Interval) * time.Second
+	}
+	step := time.Duration(metric.Baseline.Step) * time.Second
+	if step <= 0 {
+		step = defaultBaselineStep
+	}
+	confidence := metric.Baseline.Confidence
+	if confidence <= 0 {
+		confidence = defaultBaselineConfidence
+	}
+
+	canarySamples, err := _metrics.ExecuteMetricRangeQuery(context.TODO(), metricsClient, instance, metric, metricTemplate, window, step)
+	if err != nil {
+		return false, err
+	}
+
+	baseline, err := getBaselineCanary(instance)
+	if err != nil {
+		return false, err
+	}
+	baselineSamples, err := _metrics.ExecuteMetricRangeQuery(context.TODO(), metricsClient, baseline, metric, metricTemplate, window, step)
+	if err != nil {
+		return false, err
+	}
+
+	// The test tells how likely the canary is greater than the baseline, if lower is worse values are negated
+	baselineValues, canaryValues := baselineSamples, canarySamples
+	if metric.Baseline.Worse == kharonv1alpha1.BaselineDirectionLower {
+		baselineValues, canaryValues = negateSamples(baselineSamples), negateSamples(canarySamples)
+	}
+	metricStatus.PValue = _metrics.MannWhitneyU(baselineValues, canaryValues)
+	metricStatus.Value = _metrics.Median(canarySamples)
+	metricStatus.BaselineValue = _metrics.Median(baselineSamples)
+	currentCanaryMetricValue.WithLabelValues(instance.Namespace, instance.Name, instance.Spec.TargetRef.Name, metric.Name).Set(metricStatus.Value)
+
+	return metricStatus.PValue >= 1-confidence, nil
+}
+
+// NewMetricsClientForCanary returns a client for the metrics server with the credentials in MetricsServerSecret, if any
+func (r *ReconcileCanary) NewMetricsClientForCanary(instance *kharonv1alpha1.Canary) (*_metrics.MetricsClient, error) {
+	timeout := time.Duration(instance.Spec.CanaryAnalysis.MetricsServerTimeout) * time.Second
+	if len(instance.Spec.CanaryAnalysis.MetricsServerSecret) <= 0 {
+		return _metrics.NewMetricsClient(nil, timeout)
+	}
+
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.CanaryAnalysis.MetricsServerSecret, Namespace: instance.Namespace}, secret)
+	if err != nil {
+		return nil, err
+	}
+	auth := &_metrics.MetricsServerAuth{
+		BearerToken:    string(secret.Data[secretKeyToken]),
+		Username:       string(secret.Data[corev1.BasicAuthUsernameKey]),
+		Password:       string(secret.Data[corev1.BasicAuthPasswordKey]),
+		APIKey:         string(secret.Data[secretKeyAPIKey]),
+		ApplicationKey: string(secret.Data[secretKeyAppKey]),
+		CertPEM:        secret.Data[corev1.TLSCertKey],
+		KeyPEM:         secret.Data[corev1.TLSPrivateKeyKey],
+		CAPEM:          secret.Data[secretKeyCA],
+	}
+
+	return _metrics.NewMetricsClient(auth, timeout)
+}
+
+// FetchMetricTemplate gets the spec of the MetricTemplate or ClusterMetricTemplate a metric references, nil if none
+func (r *ReconcileCanary) FetchMetricTemplate(instance *kharonv1alpha1.Canary, templateRef *kharonv1alpha1.MetricTemplateRef) (*kharonv1alpha1.MetricTemplateSpec, error) {
+	if templateRef == nil {
+		return nil, nil
+	}
+
+	if templateRef.Kind == kharonv1alpha1.MetricTemplateKindCluster {
+		clusterMetricTemplate := &kharonv1alpha1.ClusterMetricTemplate{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: templateRef.Name}, clusterMetricTemplate); err != nil {
+			return nil, err
+		}
+		return &clusterMetricTemplate.Spec, nil
+	}
+
+	metricTemplate := &kharonv1alpha1.MetricTemplate{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: templateRef.Name, Namespace: instance.Namespace}, metricTemplate); err != nil {
+		return nil, err
+	}
+	return &metricTemplate.Spec, nil
+}
+
+// Returns the status of a metric by name, it's added to the status of the canary if it's not there yet
+func getMetricStatus(instance *kharonv1alpha1.Canary, name string) *kharonv1alpha1.MetricStatus {
+	for i := range instance.Status.Metrics {
+		if instance.Status.Metrics[i].Name == name {
+			return &instance.Status.Metrics[i]
+		}
+	}
+	instance.Status.Metrics = append(instance.Status.Metrics, kharonv1alpha1.MetricStatus{Name: name})
+
+	return &instance.Status.Metrics[len(instance.Status.Metrics)-1]
+}
+
+// Returns the status of a webhook by name, it's added to the status of the canary if it's not there yet
+func getWebhookStatus(instance *kharonv1alpha1.Canary, name string) *kharonv1alpha1.WebhookStatus {
+	for i := range instance.Status.Webhooks {
+		if instance.Status.Webhooks[i].Name == name {
+			return &instance.Status.Webhooks[i]
+		}
+	}
+	instance.Status.Webhooks = append(instance.Status.Webhooks, kharonv1alpha1.WebhookStatus{Name: name})
+
+	return &instance.Status.Webhooks[len(instance.Status.Webhooks)-1]
+}
+
+// Returns the requeues a metric query is retried with the retry NoDataPolicy, NoDataRetries or, if not set, 2
+func getNoDataRetries(metric *kharonv1alpha1.Metric) int32 {
+	if metric.NoDataRetries > 0 {
+		return metric.NoDataRetries
+	}
+
+	return defaultNoDataRetries
+}
+
+// Returns the failed checks a metric or webhook can afford, its failure budget or, if not set, CanaryAnalysis.Threshold
+func getFailureBudget(instance *kharonv1alpha1.Canary, failureBudget int32) int32 {
+	if failureBudget > 0 {
+		return failureBudget
+	}
+
+	return instance.Spec.CanaryAnalysis.Threshold
+}
+
+// Returns how often metrics are checked, the shortest Interval of all the metrics or, if none is set,
+// CanaryAnalysis.Interval. It's never 0 so that a running canary is always reconciled again
+func getMetricsInterval(instance *kharonv1alpha1.Canary) time.Duration {
+	interval := int32(0)
+	for _, metric := range _metrics.GetMetrics(instance) {
+		if metric.Interval > 0 && (interval <= 0 || metric.Interval < interval) {
+			interval = metric.Interval
+		}
+	}
+	if interval <= 0 {
+		interval = instance.Spec.CanaryAnalysis.Interval
+	}
+	if interval <= 0 {
+		return defaultMetricsInterval
+	}
+
+	return time.Duration(interval) * time.Second
+}
+
+// Returns a copy of the canary with TargetRef pointing to the primary release (latest in history), the baseline
+// queries of a metric are its queries rendered over this copy
+func getBaselineCanary(instance *kharonv1alpha1.Canary) (*kharonv1alpha1.Canary, error) {
+	if len(instance.Status.ReleaseHistory) <= 0 {
+		return nil, _util.NewError(errorNoReleaseInHistoryToCompare)
+	}
+	baseline := instance.DeepCopy()
+	baseline.Spec.TargetRef = instance.Status.ReleaseHistory[len(instance.Status.ReleaseHistory)-1].Ref
+
+	return baseline, nil
+}
+
+// Returns a copy of samples with their sign changed
+func negateSamples(samples []float64) []float64 {
+	negated := make([]float64, len(samples))
+	for i, sample := range samples {
+		negated[i] = -sample
+	}
+
+	return negated
+}
+
+// Queries need a known provider, reducer, multi-series and no data policy, a known operator with valid bounds
+// (unless it comes from the template or the metric has a Baseline) and no negative window, step, retries or minimum
+func isValidMetricQuery(metric *kharonv1alpha1.Metric) bool {
+	if metric.Window < 0 || metric.Step < 0 || !_metrics.IsValidReducer(metric.Reducer) || !_metrics.IsValidProvider(metric.Provider) {
+		return false
+	}
+	// The operator may come from the template, then it's checked with the template
+	if (len(metric.Operator) > 0 || metric.TemplateRef == nil) && metric.Baseline == nil &&
+		!_metrics.IsValidComparison(&_metrics.Comparison{Operator: metric.Operator, Threshold: metric.Threshold, Min: metric.Min, Max: metric.Max}) {
+		return false
+	}
+	if metric.NoDataRetries < 0 || metric.MinSamples < 0 || metric.MinRequestCount < 0 {
+		return false
+	}
+	switch metric.NoDataPolicy {
+	case kharonv1alpha1.NoDataFail, kharonv1alpha1.NoDataPass, kharonv1alpha1.NoDataSkip, kharonv1alpha1.NoDataRetry, "":
+	default:
+		return false
+	}
+	switch metric.MultiSeries {
+	case kharonv1alpha1.MultiSeriesError, kharonv1alpha1.MultiSeriesFirst, kharonv1alpha1.MultiSeriesMerge, "":
+		return true
+	default:
+		return false
+	}
+}
+
+// Metrics need a template with a known provider and, unless they have a Baseline, a known operator with valid bounds
+// either of their own or from the template
+func isValidMetricTemplate(metric *kharonv1alpha1.Metric, metricTemplate *kharonv1alpha1.MetricTemplateSpec) bool {
+	if metricTemplate != nil && !_metrics.IsValidProvider(metricTemplate.Provider) {
+		return false
+	}
+
+	return metric.Baseline != nil || _metrics.IsValidComparison(_metrics.GetMetricComparison(metric, metricTemplate))
+}
+
+// Baseline comparisons need a confidence between 0 and 1 and a known direction
+func isValidBaseline(baseline *kharonv1alpha1.BaselineSpec) bool {
+	if baseline == nil {
+		return true
+	}
+	if baseline.Confidence < 0 || baseline.Confidence >= 1 || baseline.Window < 0 || baseline.Step < 0 {
+		return false
+	}
+	switch baseline.Worse {
+	case kharonv1alpha1.BaselineDirectionHigher, kharonv1alpha1.BaselineDirectionLower, "":
+		return true
+	default:
+		return false
+	}
+}
+
+// Metrics in a list need a unique name so that their status can be told apart
+func isValidMetrics(metrics []kharonv1alpha1.Metric) bool {
+	names := map[string]bool{}
+	for _, metric := range metrics {
+		if len(metric.Name) <= 0 || names[metric.Name] {
+			return false
+		}
+		names[metric.Name] = true
+	}
+
+	return true
+}
+
+// Webhooks need a unique name so that their status can be told apart and a URL to call
+func isValidWebhooks(webhooks []kharonv1alpha1.WebhookCheck) bool {
+	names := map[string]bool{}
+	for _, webhook := range webhooks {
+		if len(webhook.Name) <= 0 || names[webhook.Name] || webhook.Timeout < 0 || webhook.FailureBudget < 0 {
+			return false
+		}
+		if webhookURL, err := url.Parse(webhook.URL); err != nil || len(webhookURL.Scheme) <= 0 || len(webhookURL.Host) <= 0 {
+			return false
+		}
+		names[webhook.Name] = true
+	}
+
+	return true
+}
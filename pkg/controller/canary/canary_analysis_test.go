@@ -0,0 +1,289 @@
+package canary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	record "k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Util
+	_metrics "github.com/redhat/kharon-operator/pkg/util/metrics"
+)
+
+// stubClient is a client.Client keeping objects in memory by name, objects not there are not found
+type stubClient struct {
+	objects map[types.NamespacedName]runtime.Object
+}
+
+func (c *stubClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	stored, ok := c.objects[key]
+	if !ok || reflect.TypeOf(stored) != reflect.TypeOf(obj) {
+		return errors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(stored.DeepCopyObject()).Elem())
+
+	return nil
+}
+
+func (c *stubClient) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	return nil
+}
+
+func (c *stubClient) Create(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (c *stubClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	return nil
+}
+
+func (c *stubClient) Update(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (c *stubClient) Status() client.StatusWriter {
+	return c
+}
+
+// Returns a reconciler with a stub client holding objects
+func newStubReconciler(objects map[types.NamespacedName]runtime.Object) *ReconcileCanary {
+	scheme := runtime.NewScheme()
+	kharonv1alpha1.SchemeBuilder.AddToScheme(scheme)
+	return &ReconcileCanary{
+		client:    &stubClient{objects: objects},
+		scheme:    scheme,
+		recorder:  record.NewFakeRecorder(100),
+		loadTests: map[types.NamespacedName]context.CancelFunc{},
+	}
+}
+
+// Starts a stub Prometheus answering each query with the samples in results, or an empty result if not there
+func newStubPrometheus(results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		value, ok := results[req.URL.Query().Get("query")]
+		if !ok {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1570000000,"` + value + `"]}]}}`))
+	}))
+}
+
+// Returns a canary at 100% whose step is over, so that the next reconcile would promote it
+func newCanaryAtFullWeight(metricsServer string, metric kharonv1alpha1.Metric) *kharonv1alpha1.Canary {
+	return &kharonv1alpha1.Canary{
+		ObjectMeta: metav1.ObjectMeta{Name: "canary", Namespace: "test"},
+		Spec: kharonv1alpha1.CanarySpec{
+			Type:                   kharonv1alpha1.Native,
+			ServiceName:            "app",
+			TargetRefContainerPort: intstr.FromInt(8080),
+			TargetRef:              kharonv1alpha1.Ref{APIVersion: "apps.openshift.io/v1", Kind: "DeploymentConfig", Name: "app-v2"},
+			CanaryAnalysis: kharonv1alpha1.CanaryAnalysis{
+				MetricsServer: metricsServer,
+				Interval:      10,
+				Threshold:     2,
+				MaxWeight:     50,
+				StepWeight:    10,
+				Metric:        metric,
+			},
+		},
+		Status: kharonv1alpha1.CanaryStatus{
+			IsCanaryRunning: true,
+			CanaryWeight:    100,
+			Iterations:      5,
+			LastStepTime:    metav1.NewTime(time.Now().Add(-time.Hour)),
+			ReleaseHistory: []kharonv1alpha1.Release{
+				{ID: "app-v1", Name: "app-v1", Ref: kharonv1alpha1.Ref{APIVersion: "apps.openshift.io/v1", Kind: "DeploymentConfig", Name: "app-v1"}},
+			},
+		},
+	}
+}
+
+func TestCanaryWithoutEnoughSamplesDoesNotPromote(t *testing.T) {
+	server := newStubPrometheus(map[string]string{"errors": "0", "requests": "3"})
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		metric kharonv1alpha1.Metric
+	}{
+		{"request count below minimum", kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors",
+			RequestCountQuery: "requests", MinRequestCount: 100}},
+		{"samples below minimum", kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors",
+			MinSamples: 5}},
+		{"no data skipped", kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "no-traffic",
+			NoDataPolicy: kharonv1alpha1.NoDataSkip}},
+	}
+	for _, test := range tests {
+		instance := newCanaryAtFullWeight(server.URL, test.metric)
+		if _, err := newStubReconciler(nil).ReconcileCanaryRelease(instance); err != nil {
+			t.Fatalf("%s: ReconcileCanaryRelease failed: %v", test.name, err)
+		}
+		if instance.Status.LastAction != kharonv1alpha1.AwaitSamples {
+			t.Errorf("%s: last action %s, want %s", test.name, instance.Status.LastAction, kharonv1alpha1.AwaitSamples)
+		}
+		if len(instance.Status.ReleaseHistory) != 1 || !instance.Status.IsCanaryRunning || instance.Status.CanaryWeight != 100 {
+			t.Errorf("%s: canary was promoted, history %v, running %t, weight %d", test.name, instance.Status.ReleaseHistory, instance.Status.IsCanaryRunning, instance.Status.CanaryWeight)
+		}
+		if instance.Status.Metrics[0].FailedChecks != 0 {
+			t.Errorf("%s: %d failed checks, want 0", test.name, instance.Status.Metrics[0].FailedChecks)
+		}
+	}
+}
+
+func TestCanaryWithoutEnoughSamplesDoesNotProgress(t *testing.T) {
+	server := newStubPrometheus(map[string]string{"errors": "0", "requests": "3"})
+	defer server.Close()
+
+	instance := newCanaryAtFullWeight(server.URL, kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors",
+		RequestCountQuery: "requests", MinRequestCount: 100})
+	instance.Status.CanaryWeight = 10
+	if _, err := newStubReconciler(nil).ReconcileCanaryRelease(instance); err != nil {
+		t.Fatalf("ReconcileCanaryRelease failed: %v", err)
+	}
+	if instance.Status.LastAction != kharonv1alpha1.AwaitSamples || instance.Status.CanaryWeight != 10 || instance.Status.Iterations != 5 {
+		t.Errorf("Canary moved on to %d%% (iteration %d) with last action %s, want it held at 10%%", instance.Status.CanaryWeight, instance.Status.Iterations, instance.Status.LastAction)
+	}
+}
+
+func TestRunMetricCheckNoDataPolicy(t *testing.T) {
+	server := newStubPrometheus(map[string]string{})
+	defer server.Close()
+	metricsClient, err := _metrics.NewMetricsClient(nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewMetricsClient failed: %v", err)
+	}
+	defer metricsClient.Close()
+
+	tests := []struct {
+		policy  kharonv1alpha1.NoDataPolicy
+		passed  bool
+		counted bool
+	}{
+		{"", false, true},
+		{kharonv1alpha1.NoDataFail, false, true},
+		{kharonv1alpha1.NoDataRetry, false, false},
+		{kharonv1alpha1.NoDataPass, true, true},
+		{kharonv1alpha1.NoDataSkip, false, false},
+	}
+	for _, test := range tests {
+		metric := kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "no-traffic", NoDataPolicy: test.policy, NoDataRetries: 1}
+		instance := newCanaryAtFullWeight(server.URL, metric)
+		passed, counted := newStubReconciler(nil).RunMetricCheck(metricsClient, instance, &metric, getMetricStatus(instance, metric.Name))
+		if passed != test.passed || counted != test.counted {
+			t.Errorf("No data with policy %q: passed %t and counted %t, want %t and %t", test.policy, passed, counted, test.passed, test.counted)
+		}
+	}
+}
+
+func TestRunMetricCheckRetriesOnTheNextRequeues(t *testing.T) {
+	server := newStubPrometheus(map[string]string{})
+	defer server.Close()
+	metricsClient, err := _metrics.NewMetricsClient(nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewMetricsClient failed: %v", err)
+	}
+	defer metricsClient.Close()
+
+	metric := kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "no-traffic", NoDataPolicy: kharonv1alpha1.NoDataRetry, NoDataRetries: 2}
+	instance := newCanaryAtFullWeight(server.URL, metric)
+	r := newStubReconciler(nil)
+	// Each reconcile runs the query once, the first two don't count and the third one fails
+	for retry := int32(1); retry <= 2; retry++ {
+		passed, counted := r.RunMetricCheck(metricsClient, instance, &metric, getMetricStatus(instance, metric.Name))
+		if passed || counted || getMetricStatus(instance, metric.Name).NoDataRetries != retry {
+			t.Fatalf("Retry %d: passed %t, counted %t and %d retries, want an uncounted check", retry, passed, counted, getMetricStatus(instance, metric.Name).NoDataRetries)
+		}
+	}
+	passed, counted := r.RunMetricCheck(metricsClient, instance, &metric, getMetricStatus(instance, metric.Name))
+	if passed || !counted || getMetricStatus(instance, metric.Name).NoDataRetries != 0 {
+		t.Errorf("Retries exhausted: passed %t, counted %t and %d retries, want a failed check", passed, counted, getMetricStatus(instance, metric.Name).NoDataRetries)
+	}
+}
+
+func TestAnyPolicyEvaluatesOnlyCountedMetrics(t *testing.T) {
+	server := newStubPrometheus(map[string]string{"errors": "5"})
+	defer server.Close()
+
+	instance := newCanaryAtFullWeight(server.URL, kharonv1alpha1.Metric{})
+	instance.Spec.CanaryAnalysis.MetricsPolicy = kharonv1alpha1.MetricsPolicyAny
+	instance.Spec.CanaryAnalysis.Metrics = []kharonv1alpha1.Metric{
+		{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors"},
+		{Name: "latency", Operator: "lt", Threshold: 1, PrometheusQuery: "no-traffic", NoDataPolicy: kharonv1alpha1.NoDataSkip},
+	}
+	if ok, counted := newStubReconciler(nil).AnalyseCanaryRelease(instance); !ok || counted {
+		t.Errorf("AnalyseCanaryRelease = %t, %t, want true, false", ok, counted)
+	}
+	if instance.Status.FailedChecks != 1 {
+		t.Errorf("%d failed checks, want 1 as the only metric evaluated failed", instance.Status.FailedChecks)
+	}
+}
+
+func TestRunMetricCheckBrokenTemplateFails(t *testing.T) {
+	server := newStubPrometheus(map[string]string{"errors": "0"})
+	defer server.Close()
+	metricsClient, err := _metrics.NewMetricsClient(nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewMetricsClient failed: %v", err)
+	}
+	defer metricsClient.Close()
+
+	objects := map[types.NamespacedName]runtime.Object{
+		{Name: "bad-operator", Namespace: "test"}: &kharonv1alpha1.MetricTemplate{Spec: kharonv1alpha1.MetricTemplateSpec{Query: "errors", Operator: "gte"}},
+		{Name: "bad-provider", Namespace: "test"}: &kharonv1alpha1.MetricTemplate{Spec: kharonv1alpha1.MetricTemplateSpec{Query: "errors", Operator: "lt", Threshold: 1, Provider: "Unknown"}},
+	}
+	for _, name := range []string{"missing", "bad-operator", "bad-provider"} {
+		for _, policy := range []kharonv1alpha1.NoDataPolicy{kharonv1alpha1.NoDataPass, kharonv1alpha1.NoDataSkip} {
+			metric := kharonv1alpha1.Metric{Name: "error-rate", TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: name}, NoDataPolicy: policy}
+			instance := newCanaryAtFullWeight(server.URL, metric)
+			passed, counted := newStubReconciler(objects).RunMetricCheck(metricsClient, instance, &metric, getMetricStatus(instance, metric.Name))
+			if passed || !counted {
+				t.Errorf("Template %s with policy %s: passed %t and counted %t, want a failed check", name, policy, passed, counted)
+			}
+		}
+	}
+}
+
+func TestIsValidResolvesMetricTemplates(t *testing.T) {
+	objects := map[types.NamespacedName]runtime.Object{
+		{Name: "error-rate", Namespace: "test"}:   &kharonv1alpha1.MetricTemplate{Spec: kharonv1alpha1.MetricTemplateSpec{Query: "errors", Operator: "lt", Threshold: 1}},
+		{Name: "no-operator", Namespace: "test"}:  &kharonv1alpha1.MetricTemplate{Spec: kharonv1alpha1.MetricTemplateSpec{Query: "errors"}},
+		{Name: "bad-bounds", Namespace: "test"}:   &kharonv1alpha1.MetricTemplate{Spec: kharonv1alpha1.MetricTemplateSpec{Query: "errors", Operator: "between", Min: 10, Max: 1}},
+		{Name: "bad-provider", Namespace: "test"}: &kharonv1alpha1.MetricTemplate{Spec: kharonv1alpha1.MetricTemplateSpec{Query: "errors", Operator: "lt", Provider: "Unknown"}},
+		{Name: "error-rate"}:                      &kharonv1alpha1.ClusterMetricTemplate{Spec: kharonv1alpha1.MetricTemplateSpec{Query: "errors", Operator: "lt", Threshold: 1}},
+	}
+
+	tests := []struct {
+		name   string
+		metric kharonv1alpha1.Metric
+		valid  bool
+	}{
+		{"template operator", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "error-rate"}}, true},
+		{"cluster template operator", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "error-rate", Kind: kharonv1alpha1.MetricTemplateKindCluster}}, true},
+		{"metric operator", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "no-operator"}, Operator: "lt", Threshold: 1}, true},
+		{"missing template", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "missing"}}, false},
+		{"missing cluster template", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "no-operator", Kind: kharonv1alpha1.MetricTemplateKindCluster}}, false},
+		{"no operator", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "no-operator"}}, false},
+		{"invalid template bounds", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "bad-bounds"}}, false},
+		{"unknown template provider", kharonv1alpha1.Metric{TemplateRef: &kharonv1alpha1.MetricTemplateRef{Name: "bad-provider"}}, false},
+	}
+	for _, test := range tests {
+		test.metric.Name = "error-rate"
+		instance := newCanaryAtFullWeight("http://prometheus:9090", test.metric)
+		if valid, err := newStubReconciler(objects).IsValid(instance); valid != test.valid {
+			t.Errorf("%s: IsValid = %t (%v), want %t", test.name, valid, err, test.valid)
+		}
+	}
+}
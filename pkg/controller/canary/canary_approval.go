@@ -0,0 +1,93 @@
+package canary
+
+import (
+	"fmt"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Annotation that approves the gate the canary is holding at, it's removed once the approval is recorded
+const approveAnnotation = "kharon.redhat.com/approve"
+
+// Gate of the promotion of the canary, weight gates are weight-N
+const promotionGate = "promotion"
+
+// IsApproved returns if a gate of the canary is approved, either before or now through the approve annotation.
+// Approvals are recorded in the status and the annotation removed so that the next gate needs a new one
+func (r *ReconcileCanary) IsApproved(instance *kharonv1alpha1.Canary, gate string) (bool, error) {
+	for _, approval := range instance.Status.Approvals {
+		if approval == gate {
+			return true, nil
+		}
+	}
+	if instance.Annotations[approveAnnotation] != "true" {
+		return false, nil
+	}
+
+	requestedBy := getRequestedBy(instance)
+	if err := r.RemoveAnnotations(instance, approveAnnotation, requestedByAnnotation); err != nil {
+		return false, err
+	}
+	instance.Status.Approvals = append(instance.Status.Approvals, gate)
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.ApproveRelease), "Canary release %s of deployment %s approved at gate %s by %s", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, gate, requestedBy)
+
+	return true, nil
+}
+
+// Returns the gate to approve before the canary goes from its current weight to nextWeight, empty if none
+func getWeightGate(instance *kharonv1alpha1.Canary, nextWeight int32) string {
+	for _, weight := range instance.Spec.Approval.Weights {
+		if instance.Status.CanaryWeight <= weight && nextWeight > weight {
+			return fmt.Sprintf("weight-%d", weight)
+		}
+	}
+
+	return ""
+}
+
+// Returns the gate to approve before the canary is promoted, empty if none
+func getPromotionGate(instance *kharonv1alpha1.Canary) string {
+	if instance.Spec.Approval.Promotion {
+		return promotionGate
+	}
+
+	return ""
+}
+
+// Approval weights have to be between 1 and 99, 100 is the promotion
+func isValidApproval(approval *kharonv1alpha1.ApprovalSpec) bool {
+	for _, weight := range approval.Weights {
+		if weight < 1 || weight > 99 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AwaitApproval holds the canary at its current weight until a gate is approved, analysis goes on meanwhile
+func (r *ReconcileCanary) AwaitApproval(instance *kharonv1alpha1.Canary, gate string) (reconcile.Result, error) {
+	log.Info("ACTION {AWAIT_APPROVAL}")
+	if instance.Status.Phase != kharonv1alpha1.CanaryPhaseAwaitingApproval {
+		instance.Status.Phase = kharonv1alpha1.CanaryPhaseAwaitingApproval
+		// Send notification event
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.AwaitApproval), "Canary release %s of deployment %s awaiting approval at gate %s, annotate it with %s=true to approve", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, gate, approveAnnotation)
+	}
+
+	return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.AwaitApproval)
+}
+
+// PauseRelease holds the canary at its current weight while Paused is true, analysis goes on meanwhile
+func (r *ReconcileCanary) PauseRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
+	log.Info("ACTION {PAUSE_RELEASE}")
+	if instance.Status.Phase != kharonv1alpha1.CanaryPhasePaused {
+		instance.Status.Phase = kharonv1alpha1.CanaryPhasePaused
+		// Send notification event
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.PauseRelease), "Canary release %s of deployment %s paused at %d%%", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, instance.Status.CanaryWeight)
+	}
+
+	return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.PauseRelease)
+}
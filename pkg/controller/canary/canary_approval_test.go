@@ -0,0 +1,49 @@
+package canary
+
+import (
+	"testing"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestIsValidRejectsApprovalUnlessCanaryStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy kharonv1alpha1.StrategyType
+		approval kharonv1alpha1.ApprovalSpec
+		valid    bool
+	}{
+		{"canary with gates", kharonv1alpha1.CanaryStrategy, kharonv1alpha1.ApprovalSpec{Weights: []int32{50}, Promotion: true}, true},
+		{"default strategy with gates", "", kharonv1alpha1.ApprovalSpec{Promotion: true}, true},
+		{"blue/green with a promotion gate", kharonv1alpha1.BlueGreenStrategy, kharonv1alpha1.ApprovalSpec{Promotion: true}, false},
+		{"blue/green with a weight gate", kharonv1alpha1.BlueGreenStrategy, kharonv1alpha1.ApprovalSpec{Weights: []int32{50}}, false},
+		{"blue/green without gates", kharonv1alpha1.BlueGreenStrategy, kharonv1alpha1.ApprovalSpec{}, true},
+	}
+	for _, test := range tests {
+		instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors"})
+		instance.Spec.Strategy = test.strategy
+		instance.Spec.BlueGreen = kharonv1alpha1.BlueGreenSpec{Iterations: 3, RollbackWindow: 60}
+		instance.Spec.Approval = test.approval
+		valid, err := newStubReconciler(nil).IsValid(instance)
+		if valid != test.valid {
+			t.Errorf("%s: IsValid = %t (%v), want %t", test.name, valid, err, test.valid)
+		}
+		if !test.valid && (!errors.IsBadRequest(err) || err.Error() != errorApprovalNotSupported) {
+			t.Errorf("%s: IsValid failed with %v, want %s", test.name, err, errorApprovalNotSupported)
+		}
+	}
+}
+
+func TestCanaryIsNotPromotedWithoutApproval(t *testing.T) {
+	instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{})
+	instance.Status.SkipAnalysis = true
+	instance.Spec.Approval.Promotion = true
+
+	if _, err := newStubReconciler(nil).ReconcileCanaryRelease(instance); err != nil {
+		t.Fatalf("ReconcileCanaryRelease failed: %v", err)
+	}
+	if instance.Status.LastAction != kharonv1alpha1.AwaitApproval || len(instance.Status.ReleaseHistory) != 1 {
+		t.Errorf("Last action %s with %d releases in history, want %s and the canary not promoted", instance.Status.LastAction, len(instance.Status.ReleaseHistory), kharonv1alpha1.AwaitApproval)
+	}
+}
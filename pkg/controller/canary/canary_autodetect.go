@@ -0,0 +1,446 @@
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Suffix of the primary Deployment and Service cloned from a watched TargetRef, also added to the values
+// of the selector labels of the primary pods so that they're told apart from the pods of TargetRef
+const primarySuffix = "-primary"
+
+// Label of the primary Deployment with the name of the canary managing it
+const primaryLabel = "kharon.redhat.com/primary"
+
+// Finalizer of the canaries watching TargetRef, they own the primary Deployment and scale TargetRef down, so
+// TargetRef has to serve again before they're deleted and the primary is garbage collected
+const targetFinalizer = "kharon.redhat.com/restore-target"
+
+// Interval to check again if the primary Deployment rolled out, status changes of Deployments are not watched
+const primaryRolloutInterval = 10 * time.Second
+
+// ReconcileAutoDetect triggers the next action of a canary watching TargetRef. The pod template promoted runs in
+// a managed primary Deployment while TargetRef is scaled down, a new pod template scales it up as the canary
+func (r *ReconcileCanary) ReconcileAutoDetect(instance *kharonv1alpha1.Canary, target runtime.Object) (reconcile.Result, error) {
+	deployment, ok := target.(*appsv1.Deployment)
+	if !ok {
+		err := errors.NewBadRequest(errorAutoDetectNotValid)
+		log.Error(err, errorAutoDetectNotValid)
+		return r.ManageError(instance, err)
+	}
+	specHash := getPodTemplateHash(&deployment.Spec.Template)
+	if !hasFinalizer(instance, targetFinalizer) {
+		instance.Finalizers = append(instance.Finalizers, targetFinalizer)
+		if err := r.client.Update(context.TODO(), instance); err != nil {
+			return r.ManageError(instance, err)
+		}
+	}
+
+	// If there's no Primary, TargetRef is cloned into it
+	if len(instance.Status.ReleaseHistory) <= 0 {
+		return r.CreatePrimaryFromTarget(instance, deployment, specHash)
+	}
+
+	switch {
+	case specHash == instance.Status.LastPromotedSpec:
+		// TargetRef is back to the pod template of the primary, if a canary was running it's withdrawn
+		instance.Status.LastAppliedSpec = specHash
+		if instance.Status.IsCanaryRunning {
+			return r.RollbackRelease(instance)
+		}
+		if err := r.ScaleTarget(instance, 0); err != nil {
+			return r.ManageError(instance, err)
+		}
+		// Commands need a canary running. Rollback is not supported either, only the pod template promoted last is kept
+		command, err := r.TakeCommand(instance)
+		if err != nil {
+			return r.ManageError(instance, err)
+		}
+		switch {
+		case command == nil:
+		case command.Name == commandRollback:
+			log.Error(errors.NewBadRequest(errorAutoDetectRollbackNotSupported), errorAutoDetectRollbackNotSupported, "Release.ID", command.RollbackTo)
+			r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.RollbackToRelease), "Canary release %s can't rollback to release %s requested by %s, rollback is not supported with autoDetect, revert the pod template of deployment %s instead", instance.ObjectMeta.Name, command.RollbackTo, command.RequestedBy, instance.Spec.TargetRef.Name)
+		default:
+			r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.UnknownCommand), "Canary release %s ignored command %s requested by %s while no canary is running", instance.ObjectMeta.Name, command.Name, command.RequestedBy)
+		}
+		log.Info("ACTION {NO_ACTION}")
+		return r.ManageSuccess(instance, 0, kharonv1alpha1.NoAction)
+	case specHash != instance.Status.LastAppliedSpec:
+		// A new pod template ==> Action: Detect Canary Release
+		return r.DetectCanaryRelease(instance, specHash)
+	case instance.Status.Phase == kharonv1alpha1.CanaryPhaseFailed:
+		// The pod template was rolled back, it's not released again until it changes
+		log.Info("ACTION {NO_ACTION}")
+		return r.ManageSuccess(instance, 0, kharonv1alpha1.NoAction)
+	default:
+		return r.ReconcileCanaryRelease(instance)
+	}
+}
+
+// CreatePrimaryFromTarget clones TargetRef into the primary Deployment and, once it rolled out, routes all traffic
+// to it and scales TargetRef down
+func (r *ReconcileCanary) CreatePrimaryFromTarget(instance *kharonv1alpha1.Canary, target *appsv1.Deployment, specHash string) (reconcile.Result, error) {
+	log.Info("ACTION {CREATE_PRIMARY_RELEASE}")
+	primary, err := r.CreateOrUpdatePrimary(instance, target)
+	if err != nil {
+		return r.ManageError(instance, err)
+	}
+	primaryService, err := r.CreateService(instance, primary.Name, getPrimaryLabels(instance.Spec.TargetRefSelector, instance.Spec.TargetRefSelector))
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return r.ManageError(instance, err)
+	}
+	// TargetRef keeps serving until the primary pods are available
+	if !isRolledOut(primary) {
+		return r.AwaitPrimary(instance, primary)
+	}
+
+	// Create a Route (or whatever the router uses) that points to the primary with no alternate service
+	router, err := NewRouterForCanary(instance, r.client, r.scheme)
+	if err != nil {
+		return r.ManageError(instance, err)
+	}
+	if err := router.CreateDestinations(instance, &DestinationServiceDef{Name: primaryService.Name, Weight: 100}, &DestinationServiceDef{}); err != nil {
+		return r.ManageError(instance, err)
+	}
+	if err := r.ScaleTarget(instance, 0); err != nil {
+		return r.ManageError(instance, err)
+	}
+
+	// Update Status with new Release!
+	instance.Status.IsCanaryRunning = false
+	instance.Status.CanaryWeight = 0
+	instance.Status.Iterations = 0
+	instance.Status.LastAppliedSpec = specHash
+	instance.Status.LastPromotedSpec = specHash
+	instance.Status.ReleaseHistory = append(instance.Status.ReleaseHistory, getPrimaryRelease(instance, specHash))
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.CreatePrimaryRelease), "Primary release deployed from %s as %s", instance.Spec.TargetRef.Name, primary.Name)
+
+	return r.ManageSuccess(instance, time.Duration(instance.Spec.CanaryAnalysis.Interval)*time.Second, kharonv1alpha1.CreatePrimaryRelease)
+}
+
+// DetectCanaryRelease starts a canary release of a new pod template of TargetRef, scaled up to the replicas of the primary.
+// If a canary of a previous pod template was running, traffic goes back to the primary and the release starts over
+func (r *ReconcileCanary) DetectCanaryRelease(instance *kharonv1alpha1.Canary, specHash string) (reconcile.Result, error) {
+	log.Info("ACTION {DETECT_CANARY_RELEASE}")
+	if instance.Status.IsCanaryRunning {
+		primaryService := &DestinationServiceDef{
+			Name:   instance.Status.ReleaseHistory[len(instance.Status.ReleaseHistory)-1].Name,
+			Weight: 100,
+		}
+		if err := r.UpdateDestinationsForCanary(instance, primaryService, &DestinationServiceDef{}); err != nil {
+			return r.ManageError(instance, err)
+		}
+		if err := r.StopLoadTest(instance); err != nil {
+			log.Error(err, errorStoppingLoadTest, "Canary.Name", instance.Name)
+		}
+	}
+	if _, err := r.CreateServiceForTargetRef(instance); err != nil && !errors.IsAlreadyExists(err) {
+		return r.ManageError(instance, err)
+	}
+	replicas, err := r.getPrimaryReplicas(instance)
+	if err != nil {
+		return r.ManageError(instance, err)
+	}
+	if err := r.ScaleTarget(instance, replicas); err != nil {
+		return r.ManageError(instance, err)
+	}
+
+	// Update Status with the new canary, pods get the interval to come up before the first step
+	instance.Status.IsCanaryRunning = false
+	instance.Status.CanaryWeight = 0
+	instance.Status.Iterations = 0
+	instance.Status.MirrorIterations = 0
+	instance.Status.FailedChecks = 0
+	instance.Status.Metrics = nil
+	instance.Status.Webhooks = nil
+	instance.Status.Hooks = nil
+	instance.Status.Phase = ""
+	instance.Status.Approvals = nil
+	instance.Status.SkipAnalysis = false
+	instance.Status.Promoted = false
+	instance.Status.LastStepTime = metav1.Time{}
+	instance.Status.LastAppliedSpec = specHash
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.DetectCanaryRelease), "Canary release %s detected a new pod template %s in deployment %s", instance.ObjectMeta.Name, specHash, instance.Spec.TargetRef.Name)
+
+	return r.ManageSuccess(instance, time.Duration(instance.Spec.CanaryAnalysis.Interval)*time.Second, kharonv1alpha1.DetectCanaryRelease)
+}
+
+// PromoteTargetToPrimary copies the pod template of TargetRef into the primary Deployment and returns the new release
+// and the primary Deployment, whose rollout may not be over. The pod template has to be the one analysed, otherwise
+// the next reconcile starts over with the new one
+func (r *ReconcileCanary) PromoteTargetToPrimary(instance *kharonv1alpha1.Canary) (*kharonv1alpha1.Release, *appsv1.Deployment, error) {
+	target := &appsv1.Deployment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.TargetRef.Name, Namespace: instance.Namespace}, target); err != nil {
+		return nil, nil, err
+	}
+	if specHash := getPodTemplateHash(&target.Spec.Template); specHash != instance.Status.LastAppliedSpec {
+		err := errors.NewBadRequest(errorTargetChangedBeforePromotion)
+		log.Error(err, errorTargetChangedBeforePromotion, "Spec.Hash", specHash)
+		return nil, nil, err
+	}
+	primary, err := r.CreateOrUpdatePrimary(instance, target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	release := getPrimaryRelease(instance, instance.Status.LastAppliedSpec)
+	return &release, primary, nil
+}
+
+// AwaitPrimary holds the release, traffic and TargetRef as they are, until the primary Deployment rolled out
+func (r *ReconcileCanary) AwaitPrimary(instance *kharonv1alpha1.Canary, primary *appsv1.Deployment) (reconcile.Result, error) {
+	log.Info("ACTION {AWAIT_PRIMARY}")
+	if instance.Status.LastAction != kharonv1alpha1.AwaitPrimary {
+		// Send notification event
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.AwaitPrimary), "Canary release %s waiting for deployment %s to roll out", instance.ObjectMeta.Name, primary.Name)
+	}
+
+	return r.ManageSuccess(instance, primaryRolloutInterval, kharonv1alpha1.AwaitPrimary)
+}
+
+// RestoreTarget scales TargetRef back up to the replicas of the primary Deployment and, once it rolled out, routes
+// all traffic to it and removes the finalizer of the canary, so that the primary is garbage collected with it
+func (r *ReconcileCanary) RestoreTarget(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
+	log.Info("ACTION {RESTORE_TARGET}")
+	if len(instance.Status.ReleaseHistory) > 0 {
+		replicas, err := r.getPrimaryReplicas(instance)
+		if err != nil && !errors.IsNotFound(err) {
+			return r.ManageError(instance, err)
+		} else if err != nil {
+			replicas = 1
+		}
+		if err := r.ScaleTarget(instance, replicas); err != nil {
+			return r.ManageError(instance, err)
+		}
+		target := &appsv1.Deployment{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.TargetRef.Name, Namespace: instance.Namespace}, target); err != nil {
+			return r.ManageError(instance, err)
+		}
+		// The primary keeps serving until the pods of TargetRef are available
+		if !isRolledOut(target) {
+			return r.ManageSuccess(instance, primaryRolloutInterval, kharonv1alpha1.RestoreTarget)
+		}
+		if _, err := r.CreateServiceForTargetRef(instance); err != nil && !errors.IsAlreadyExists(err) {
+			return r.ManageError(instance, err)
+		}
+		targetService := &DestinationServiceDef{
+			Name:   instance.Spec.TargetRef.Name,
+			Weight: 100,
+		}
+		if err := r.UpdateDestinationsForCanary(instance, targetService, &DestinationServiceDef{}); err != nil {
+			return r.ManageError(instance, err)
+		}
+		if err := r.StopLoadTest(instance); err != nil {
+			log.Error(err, errorStoppingLoadTest, "Canary.Name", instance.Name)
+		}
+	}
+
+	finalizers := []string{}
+	for _, finalizer := range instance.Finalizers {
+		if finalizer != targetFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	instance.Finalizers = finalizers
+	if err := r.client.Update(context.TODO(), instance); err != nil {
+		return r.ManageError(instance, err)
+	}
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.RestoreTarget), "Canary release %s deleted, deployment %s restored", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name)
+
+	return reconcile.Result{}, nil
+}
+
+// CreateOrUpdatePrimary creates the primary Deployment as a clone of TargetRef or updates its pod template with the one of TargetRef
+func (r *ReconcileCanary) CreateOrUpdatePrimary(instance *kharonv1alpha1.Canary, target *appsv1.Deployment) (*appsv1.Deployment, error) {
+	primary := &appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: getPrimaryName(instance), Namespace: instance.Namespace}, primary)
+	if err != nil && errors.IsNotFound(err) {
+		primary = newPrimaryDeployment(instance, target)
+		// Set Canary instance as the owner and controller
+		if err := controllerutil.SetControllerReference(instance, primary, r.scheme); err != nil {
+			return nil, err
+		}
+		log.Info("Creating the primary deployment", "Primary.Namespace", primary.Namespace, "Primary.Name", primary.Name)
+		return primary, r.client.Create(context.TODO(), primary)
+	} else if err != nil {
+		return nil, err
+	}
+
+	primary.Spec.Template = *getPrimaryTemplate(instance, target)
+	log.Info("Updating the primary deployment", "Primary.Namespace", primary.Namespace, "Primary.Name", primary.Name)
+	return primary, r.client.Update(context.TODO(), primary)
+}
+
+// ScaleTarget sets the replicas of the TargetRef Deployment, its pod template is left as it is
+func (r *ReconcileCanary) ScaleTarget(instance *kharonv1alpha1.Canary, replicas int32) error {
+	target := &appsv1.Deployment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.TargetRef.Name, Namespace: instance.Namespace}, target); err != nil {
+		return err
+	}
+	if target.Spec.Replicas != nil && *target.Spec.Replicas == replicas {
+		return nil
+	}
+
+	target.Spec.Replicas = &replicas
+	return r.client.Update(context.TODO(), target)
+}
+
+// Returns the replicas of the primary Deployment, those the canary is scaled to
+func (r *ReconcileCanary) getPrimaryReplicas(instance *kharonv1alpha1.Canary) (int32, error) {
+	primary := &appsv1.Deployment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: getPrimaryName(instance), Namespace: instance.Namespace}, primary); err != nil {
+		return 0, err
+	}
+	if primary.Spec.Replicas == nil {
+		return 1, nil
+	}
+
+	return *primary.Spec.Replicas, nil
+}
+
+// A Deployment rolled out once its controller saw the latest spec, every replica runs the latest pod template
+// and is available, and no replica of a previous pod template is left
+func isRolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// Returns requests for the canaries watching a Deployment, so that a new pod template is detected right away
+func getCanariesForDeployment(c client.Client, obj handler.MapObject) []reconcile.Request {
+	canaries := &kharonv1alpha1.CanaryList{}
+	if err := c.List(context.TODO(), client.InNamespace(obj.Meta.GetNamespace()), canaries); err != nil {
+		log.Error(err, "Unable to list canaries", "Deployment.Name", obj.Meta.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, canary := range canaries.Items {
+		if canary.Spec.AutoDetect && canary.Spec.TargetRef.Kind == "Deployment" && canary.Spec.TargetRef.Name == obj.Meta.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: canary.Name, Namespace: canary.Namespace}})
+		}
+	}
+
+	return requests
+}
+
+// Returns true if the canary has a finalizer
+func hasFinalizer(instance *kharonv1alpha1.Canary, finalizer string) bool {
+	for _, f := range instance.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the hash of a pod template, it changes with the image, environment... of the containers
+func getPodTemplateHash(template *corev1.PodTemplateSpec) string {
+	hash := fnv.New64a()
+	data, _ := json.Marshal(template)
+	hash.Write(data)
+
+	return strconv.FormatUint(hash.Sum64(), 10)
+}
+
+// Returns the name of the primary Deployment and Service
+func getPrimaryName(instance *kharonv1alpha1.Canary) string {
+	return instance.Spec.TargetRef.Name + primarySuffix
+}
+
+// Returns the release of the primary Deployment running a pod template
+func getPrimaryRelease(instance *kharonv1alpha1.Canary, specHash string) kharonv1alpha1.Release {
+	return kharonv1alpha1.Release{
+		ID:   specHash,
+		Name: getPrimaryName(instance),
+		Ref: kharonv1alpha1.Ref{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       getPrimaryName(instance),
+		},
+	}
+}
+
+// Returns a copy of labels where the keys in selector have their value suffixed with -primary
+func getPrimaryLabels(labels map[string]string, selector map[string]string) map[string]string {
+	primaryLabels := map[string]string{}
+	for key, value := range labels {
+		primaryLabels[key] = value
+	}
+	for key, value := range selector {
+		primaryLabels[key] = value + primarySuffix
+	}
+
+	return primaryLabels
+}
+
+// Returns the pod template of TargetRef with the labels of the primary pods
+func getPrimaryTemplate(instance *kharonv1alpha1.Canary, target *appsv1.Deployment) *corev1.PodTemplateSpec {
+	template := target.Spec.Template.DeepCopy()
+	template.Labels = getPrimaryLabels(getPrimaryLabels(template.Labels, target.Spec.Selector.MatchLabels), instance.Spec.TargetRefSelector)
+
+	return template
+}
+
+// Creates the primary Deployment out of TargetRef, selecting only the primary pods
+func newPrimaryDeployment(instance *kharonv1alpha1.Canary, target *appsv1.Deployment) *appsv1.Deployment {
+	annotations := map[string]string{
+		"openshift.io/generated-by": operatorName,
+	}
+	labels := getPrimaryLabels(target.Labels, nil)
+	labels[primaryLabel] = instance.Name
+	spec := target.Spec.DeepCopy()
+	spec.Selector = &metav1.LabelSelector{
+		MatchLabels:      getPrimaryLabels(target.Spec.Selector.MatchLabels, target.Spec.Selector.MatchLabels),
+		MatchExpressions: target.Spec.Selector.MatchExpressions,
+	}
+	spec.Template = *getPrimaryTemplate(instance, target)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        getPrimaryName(instance),
+			Namespace:   instance.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *spec,
+	}
+}
+
+// Only Deployments following a canary strategy can be watched for new pod templates
+func isValidAutoDetect(instance *kharonv1alpha1.Canary) bool {
+	if !instance.Spec.AutoDetect {
+		return true
+	}
+
+	return instance.Spec.TargetRef.Kind == "Deployment" &&
+		(instance.Spec.Strategy == kharonv1alpha1.CanaryStrategy || instance.Spec.Strategy == "")
+}
@@ -0,0 +1,203 @@
+package canary
+
+import (
+	"strings"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	record "k8s.io/client-go/tools/record"
+)
+
+func TestIsRolledOut(t *testing.T) {
+	three := int32(3)
+	tests := []struct {
+		name       string
+		generation int64
+		replicas   *int32
+		status     appsv1.DeploymentStatus
+		rolledOut  bool
+	}{
+		{"rolled out", 2, &three, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}, true},
+		{"one replica by default", 1, nil, appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}, true},
+		{"spec not observed yet", 3, &three, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}, false},
+		{"replicas not updated yet", 2, &three, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 3}, false},
+		{"old replicas left", 2, &three, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 4}, false},
+		{"replicas not available yet", 2, &three, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2}, false},
+		{"just created", 1, &three, appsv1.DeploymentStatus{}, false},
+	}
+	for _, test := range tests {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Generation: test.generation}, Spec: appsv1.DeploymentSpec{Replicas: test.replicas}, Status: test.status}
+		if rolledOut := isRolledOut(deployment); rolledOut != test.rolledOut {
+			t.Errorf("%s: isRolledOut = %t, want %t", test.name, rolledOut, test.rolledOut)
+		}
+	}
+}
+
+// Returns a canary watching the app-v2 Deployment and the objects of the stub client, app-v2, app-v2-primary with
+// status and the app Route
+func newAutoDetectCanary(primaryStatus appsv1.DeploymentStatus) (*kharonv1alpha1.Canary, map[types.NamespacedName]runtime.Object) {
+	instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{})
+	instance.Spec.AutoDetect = true
+	instance.Spec.TargetRef = kharonv1alpha1.Ref{APIVersion: "apps/v1", Kind: "Deployment", Name: "app-v2"}
+	instance.Status.SkipAnalysis = true
+
+	one := int32(1)
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}}
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "app"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app:v2"}}},
+	}
+	target := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-v2", Namespace: "test"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &one, Selector: selector, Template: template},
+	}
+	primary := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-v2-primary", Namespace: "test", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &one, Selector: selector, Template: template},
+		Status:     primaryStatus,
+	}
+	instance.Status.LastAppliedSpec = getPodTemplateHash(&target.Spec.Template)
+
+	return instance, map[types.NamespacedName]runtime.Object{
+		{Name: "app-v2", Namespace: "test"}:         target,
+		{Name: "app-v2-primary", Namespace: "test"}: primary,
+		{Name: "app", Namespace: "test"}:            &routev1.Route{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "test"}},
+	}
+}
+
+func TestPrimaryIsCreatedOnceRolledOut(t *testing.T) {
+	rolledOut := appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	tests := []struct {
+		name    string
+		status  appsv1.DeploymentStatus
+		created bool
+	}{
+		{"rolling out", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1}, false},
+		{"rolled out", rolledOut, true},
+	}
+	for _, test := range tests {
+		instance, objects := newAutoDetectCanary(test.status)
+		instance.Status = kharonv1alpha1.CanaryStatus{}
+		target := objects[types.NamespacedName{Name: "app-v2", Namespace: "test"}].(*appsv1.Deployment)
+		if _, err := newStubReconciler(objects).CreatePrimaryFromTarget(instance, target, getPodTemplateHash(&target.Spec.Template)); err != nil {
+			t.Fatalf("%s: CreatePrimaryFromTarget failed: %v", test.name, err)
+		}
+		if created := len(instance.Status.ReleaseHistory) > 0; created != test.created {
+			t.Errorf("%s: primary release created %t, want %t", test.name, created, test.created)
+		}
+		if !test.created && instance.Status.LastAction != kharonv1alpha1.AwaitPrimary {
+			t.Errorf("%s: last action %s, want %s", test.name, instance.Status.LastAction, kharonv1alpha1.AwaitPrimary)
+		}
+	}
+}
+
+func TestCanaryIsPromotedOnceThePrimaryRolledOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   appsv1.DeploymentStatus
+		promoted bool
+	}{
+		{"spec not observed yet", appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}, false},
+		{"old replica left", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 2}, false},
+		{"rolled out", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}, true},
+	}
+	for _, test := range tests {
+		instance, objects := newAutoDetectCanary(test.status)
+		if _, err := newStubReconciler(objects).EndCanaryRelease(instance); err != nil {
+			t.Fatalf("%s: EndCanaryRelease failed: %v", test.name, err)
+		}
+		if promoted := len(instance.Status.ReleaseHistory) > 1; promoted != test.promoted {
+			t.Errorf("%s: canary promoted %t, want %t (%s)", test.name, promoted, test.promoted, instance.Status.ReconcileStatus.Reason)
+		}
+		if !test.promoted && (instance.Status.LastAction != kharonv1alpha1.AwaitPrimary || !instance.Status.IsCanaryRunning || instance.Status.CanaryWeight != 100) {
+			t.Errorf("%s: last action %s, running %t at %d%%, want %s with the canary still at 100%%", test.name, instance.Status.LastAction,
+				instance.Status.IsCanaryRunning, instance.Status.CanaryWeight, kharonv1alpha1.AwaitPrimary)
+		}
+	}
+}
+
+func TestRollbackIsRejectedWithAutoDetect(t *testing.T) {
+	instance, objects := newAutoDetectCanary(appsv1.DeploymentStatus{})
+	target := objects[types.NamespacedName{Name: "app-v2", Namespace: "test"}].(*appsv1.Deployment)
+	instance.Status.IsCanaryRunning = false
+	instance.Status.LastPromotedSpec = getPodTemplateHash(&target.Spec.Template)
+	instance.Annotations = map[string]string{commandAnnotation: commandRollback, rollbackToAnnotation: "app-v1"}
+	r := newStubReconciler(objects)
+
+	if _, err := r.ReconcileAutoDetect(instance, target); err != nil {
+		t.Fatalf("ReconcileAutoDetect failed: %v", err)
+	}
+	event := <-r.recorder.(*record.FakeRecorder).Events
+	if !strings.HasPrefix(event, "Warning "+string(kharonv1alpha1.RollbackToRelease)) || !strings.Contains(event, "not supported with autoDetect") {
+		t.Errorf("Event %q, want a warning that rollback is not supported", event)
+	}
+	if len(instance.Status.ReleaseHistory) != 1 || instance.Status.LastAction != kharonv1alpha1.NoAction {
+		t.Errorf("Last action %s with %d releases, want %s with history untouched", instance.Status.LastAction, len(instance.Status.ReleaseHistory), kharonv1alpha1.NoAction)
+	}
+}
+
+func TestPromoteCommandKeepsTheWeightUntilThePrimaryRolledOut(t *testing.T) {
+	instance, objects := newAutoDetectCanary(appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1})
+	instance.Status.CanaryWeight = 30
+	r := newStubReconciler(objects)
+
+	if _, err := r.PromoteRelease(instance, "admin"); err != nil {
+		t.Fatalf("PromoteRelease failed: %v", err)
+	}
+	if instance.Status.LastAction != kharonv1alpha1.AwaitPrimary || instance.Status.CanaryWeight != 30 || !instance.Status.Promoted {
+		t.Fatalf("Last action %s at %d%%, promoted %t, want %s at 30%% until the primary rolled out", instance.Status.LastAction,
+			instance.Status.CanaryWeight, instance.Status.Promoted, kharonv1alpha1.AwaitPrimary)
+	}
+
+	primary := objects[types.NamespacedName{Name: "app-v2-primary", Namespace: "test"}].(*appsv1.Deployment)
+	primary.Status.AvailableReplicas = 1
+	if _, err := r.ReconcileCanaryRelease(instance); err != nil {
+		t.Fatalf("ReconcileCanaryRelease failed: %v", err)
+	}
+	if len(instance.Status.ReleaseHistory) != 2 || instance.Status.Promoted || instance.Status.LastAction != kharonv1alpha1.EndCanaryRelease {
+		t.Errorf("Last action %s with %d releases, promoted %t, want the canary promoted", instance.Status.LastAction, len(instance.Status.ReleaseHistory), instance.Status.Promoted)
+	}
+}
+
+func TestDeletedCanaryRestoresTargetOnceRolledOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   appsv1.DeploymentStatus
+		restored bool
+	}{
+		{"scaling up", appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1}, false},
+		{"rolled out", appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}, true},
+	}
+	for _, test := range tests {
+		instance, objects := newAutoDetectCanary(appsv1.DeploymentStatus{})
+		target := objects[types.NamespacedName{Name: "app-v2", Namespace: "test"}].(*appsv1.Deployment)
+		instance.Status.LastPromotedSpec = getPodTemplateHash(&target.Spec.Template)
+		instance.Status.IsCanaryRunning = false
+		r := newStubReconciler(objects)
+		if _, err := r.ReconcileAutoDetect(instance, target); err != nil {
+			t.Fatalf("%s: ReconcileAutoDetect failed: %v", test.name, err)
+		}
+		if !hasFinalizer(instance, targetFinalizer) {
+			t.Fatalf("%s: finalizers %v, want %s", test.name, instance.Finalizers, targetFinalizer)
+		}
+
+		now := metav1.Now()
+		instance.DeletionTimestamp = &now
+		target.Status = test.status
+		if _, err := r.RestoreTarget(instance); err != nil {
+			t.Fatalf("%s: RestoreTarget failed: %v", test.name, err)
+		}
+		if restored := !hasFinalizer(instance, targetFinalizer); restored != test.restored {
+			t.Errorf("%s: target restored %t, want %t", test.name, restored, test.restored)
+		}
+		if !test.restored && instance.Status.LastAction != kharonv1alpha1.RestoreTarget {
+			t.Errorf("%s: last action %s, want %s", test.name, instance.Status.LastAction, kharonv1alpha1.RestoreTarget)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Annotations to send commands to a running canary, the command annotation is removed once the command is run.
+// Kharon can't tell who annotated the canary, so requested-by is self-reported: whoever annotates it says who they
+// are and nothing checks it. Events and logs say so, the API server audit log is the one to trust
+const (
+	commandAnnotation          = "kharon.redhat.com/command"
+	requestedByAnnotation      = "kharon.redhat.com/requested-by"
+	rollbackToAnnotation       = "kharon.redhat.com/rollback-to"
+	rollbackStrategyAnnotation = "kharon.redhat.com/rollback-strategy"
+)
+
+// Commands of the command annotation
+const (
+	// Ends the release right away, as if the canary had reached 100%
+	commandPromote = "promote"
+	// Rolls the release back right away, as if the canary had run out of failure budget
+	commandAbort = "abort"
+	// Stops analysing the canary, it progresses on the timer alone until the release ends or is rolled back
+	commandSkipAnalysis = "skipAnalysis"
+	// Goes back to the release in history with the ID in rollback-to, only if no canary is running. Not supported
+	// with AutoDetect, reverting the pod template of TargetRef releases the previous one instead
+	commandRollback = "rollback"
+)
+
+// Strategies of the rollback command
+const (
+	// All traffic is switched to the release at once
+	rollbackStrategyInstant = "Instant"
+	// The release becomes the canary of a regular canary release
+	rollbackStrategyCanary = "Canary"
+)
+
+// Command defines a command sent through the annotations of the canary
+type Command struct {
+	Name string
+	// Self-reported requester, see getRequestedBy
+	RequestedBy string
+	// Only for rollback, ID of the release to go back to and strategy, if empty Instant
+	RollbackTo       string
+	RollbackStrategy string
+}
+
+// Requester recorded if the canary has no requested-by annotation
+const unknownRequester = "unknown"
+
+// Requester recorded from the requested-by annotation, which is not verified
+const selfReportedRequester = "%s (self-reported)"
+
+// TakeCommand returns the command in the annotations of the canary, nil if none. The annotations are removed so
+// that the command is run once
+func (r *ReconcileCanary) TakeCommand(instance *kharonv1alpha1.Canary) (*Command, error) {
+	if len(instance.Annotations[commandAnnotation]) <= 0 {
+		return nil, nil
+	}
+
+	command := &Command{
+		Name:             instance.Annotations[commandAnnotation],
+		RequestedBy:      getRequestedBy(instance),
+		RollbackTo:       instance.Annotations[rollbackToAnnotation],
+		RollbackStrategy: instance.Annotations[rollbackStrategyAnnotation],
+	}
+	if err := r.RemoveAnnotations(instance, commandAnnotation, requestedByAnnotation, rollbackToAnnotation, rollbackStrategyAnnotation); err != nil {
+		return nil, err
+	}
+	log.Info("Command received", "Command", command.Name, "RequestedBy", command.RequestedBy)
+
+	return command, nil
+}
+
+// PromoteRelease ends the release right away whatever the weight of the canary, analysis, gates and hooks. The
+// canary keeps its weight until traffic is switched, with AutoDetect once the primary rolled out
+func (r *ReconcileCanary) PromoteRelease(instance *kharonv1alpha1.Canary, requestedBy string) (reconcile.Result, error) {
+	log.Info("ACTION {PROMOTE_RELEASE}")
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.PromoteRelease), "Canary release %s of deployment %s promoted at %d%% by %s", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, instance.Status.CanaryWeight, requestedBy)
+
+	instance.Status.Promoted = true
+	return r.EndCanaryRelease(instance)
+}
+
+// AbortRelease rolls the release back right away whatever its failed checks
+func (r *ReconcileCanary) AbortRelease(instance *kharonv1alpha1.Canary, requestedBy string) (reconcile.Result, error) {
+	log.Info("ACTION {ABORT_RELEASE}")
+	// Send notification event
+	r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.AbortRelease), "Canary release %s of deployment %s aborted at %d%% by %s", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, instance.Status.CanaryWeight, requestedBy)
+
+	return r.RollbackRelease(instance)
+}
+
+// SkipAnalysis stops analysing the canary until the release ends or is rolled back
+func (r *ReconcileCanary) SkipAnalysis(instance *kharonv1alpha1.Canary, requestedBy string) {
+	log.Info("ACTION {SKIP_ANALYSIS}")
+	instance.Status.SkipAnalysis = true
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.SkipAnalysis), "Canary release %s of deployment %s no longer analysed as requested by %s", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, requestedBy)
+}
+
+// RollbackToRelease goes back to a release in history, either switching all traffic to it at once and adding it
+// to history again or turning it into the canary of a regular canary release
+func (r *ReconcileCanary) RollbackToRelease(instance *kharonv1alpha1.Canary, command *Command) (reconcile.Result, error) {
+	log.Info("ACTION {ROLLBACK_TO_RELEASE}")
+	release := getReleaseFromHistory(instance, command.RollbackTo)
+	if release == nil {
+		err := errors.NewBadRequest(errorReleaseNotInHistory)
+		log.Error(err, errorReleaseNotInHistory, "Release.ID", command.RollbackTo)
+		r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.RollbackToRelease), "Canary release %s can't rollback to release %s requested by %s, it's not in history or it's the current one", instance.ObjectMeta.Name, command.RollbackTo, command.RequestedBy)
+		return r.ManageError(instance, err)
+	}
+	fromTarget := instance.Spec.TargetRef
+	instance.Spec.TargetRef = release.Ref
+
+	switch command.RollbackStrategy {
+	case rollbackStrategyCanary:
+		// With TargetRef pointing to the release, the next reconcile starts a canary release towards it
+		if err := r.UpdateKeepingStatus(instance); err != nil {
+			return r.ManageError(instance, err)
+		}
+		// Send notification event
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.RollbackToRelease), "Canary release %s rolling back from %s to release %s through a canary as requested by %s", instance.ObjectMeta.Name, fromTarget.Name, release.ID, command.RequestedBy)
+		return r.ManageSuccess(instance, 0, kharonv1alpha1.RollbackToRelease)
+	case rollbackStrategyInstant, "":
+		// The Service of the release is usually there, just in case
+		targetService, err := r.CreateServiceForTargetRef(instance)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return r.ManageError(instance, err)
+		}
+		primaryService := &DestinationServiceDef{
+			Name:   targetService.Name,
+			Weight: 100,
+		}
+		canaryService := &DestinationServiceDef{}
+		if err := r.UpdateDestinationsForCanary(instance, primaryService, canaryService); err != nil {
+			return r.ManageError(instance, err)
+		}
+		if err := r.UpdateKeepingStatus(instance); err != nil {
+			return r.ManageError(instance, err)
+		}
+
+		// Update Status with the release back in history
+		instance.Status.ReleaseHistory = append(instance.Status.ReleaseHistory, kharonv1alpha1.Release{
+			ID:   release.ID,
+			Name: release.Name,
+			Ref:  release.Ref,
+		})
+
+		// Send notification event
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.RollbackToRelease), "Canary release %s rolled back from %s to release %s as requested by %s", instance.ObjectMeta.Name, fromTarget.Name, release.ID, command.RequestedBy)
+		return r.ManageSuccess(instance, time.Duration(instance.Spec.CanaryAnalysis.Interval)*time.Second, kharonv1alpha1.RollbackToRelease)
+	default:
+		err := errors.NewBadRequest(errorRollbackStrategyNotSupported)
+		log.Error(err, errorRollbackStrategyNotSupported, "Strategy", command.RollbackStrategy)
+		return r.ManageError(instance, err)
+	}
+}
+
+// RemoveAnnotations removes annotations from the canary keeping the status of this reconcile
+func (r *ReconcileCanary) RemoveAnnotations(instance *kharonv1alpha1.Canary, keys ...string) error {
+	for _, key := range keys {
+		delete(instance.Annotations, key)
+	}
+
+	return r.UpdateKeepingStatus(instance)
+}
+
+// UpdateKeepingStatus updates the canary, the status of this reconcile is restored afterwards as updating the object
+// brings back the stored one
+func (r *ReconcileCanary) UpdateKeepingStatus(instance *kharonv1alpha1.Canary) error {
+	status := instance.Status.DeepCopy()
+	if err := r.client.Update(context.TODO(), instance); err != nil {
+		log.Error(err, errorUnableToUpdateInstance, "instance", instance)
+		return err
+	}
+	instance.Status = *status
+
+	return nil
+}
+
+// Returns the latest release in history with an ID, the current release (latest in history) excluded, nil if none
+func getReleaseFromHistory(instance *kharonv1alpha1.Canary, id string) *kharonv1alpha1.Release {
+	for i := len(instance.Status.ReleaseHistory) - 2; i >= 0; i-- {
+		if instance.Status.ReleaseHistory[i].ID == id {
+			return &instance.Status.ReleaseHistory[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns who says they requested a command or approval, the requested-by annotation marked as self-reported or,
+// if not set, unknown. It's not verified, anyone allowed to annotate the canary can set any name
+func getRequestedBy(instance *kharonv1alpha1.Canary) string {
+	if requestedBy := instance.Annotations[requestedByAnnotation]; len(requestedBy) > 0 {
+		return fmt.Sprintf(selfReportedRequester, requestedBy)
+	}
+
+	return unknownRequester
+}
@@ -0,0 +1,25 @@
+package canary
+
+import (
+	"testing"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+)
+
+func TestGetRequestedByIsSelfReported(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		requestedBy string
+	}{
+		{map[string]string{requestedByAnnotation: "alice"}, "alice (self-reported)"},
+		{map[string]string{requestedByAnnotation: ""}, unknownRequester},
+		{nil, unknownRequester},
+	}
+	for _, test := range tests {
+		instance := &kharonv1alpha1.Canary{}
+		instance.Annotations = test.annotations
+		if requestedBy := getRequestedBy(instance); requestedBy != test.requestedBy {
+			t.Errorf("getRequestedBy with annotations %v = %q, want %q", test.annotations, requestedBy, test.requestedBy)
+		}
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -54,6 +56,29 @@ const (
 	errorTargetRefKind                    = "Not a proper Canary object because TargetRef is not Deployment or DeploymentConfig"
 	errorServiceNameEmpty                 = "Not a proper Canary object because ServiceName is empty"
 	errorCanaryAnalysisEmpty              = "Not a proper Canary object because CanaryAnalysis is empty"
+	errorGatewayAPIParentRefsEmpty        = "Not a proper Canary object because GatewayAPI.ParentRefs is empty"
+	errorReplicaRatioReplicasNotValid     = "Not a proper Canary object because ReplicaRatio.Replicas is less than 2, one for the primary and one for the canary"
+	errorReplicaRatioSelectorEmpty        = "Not a proper Canary object because ReplicaRatio.Selector is empty"
+	errorStrategyNotSupported             = "Not a proper Canary object because Strategy is not supported"
+	errorBlueGreenNotSupported            = "Not a proper Canary object because Type doesn't support a preview for BlueGreen"
+	errorBlueGreenIterationsNotValid      = "Not a proper Canary object because BlueGreen.Iterations is not greater than 0"
+	errorABTestingNotSupported            = "Not a proper Canary object because Type doesn't support match rules for ABTesting"
+	errorABTestingIterationsNotValid      = "Not a proper Canary object because ABTesting.Iterations is not greater than 0"
+	errorABTestingMatchNotValid           = "Not a proper Canary object because ABTesting.Match is empty or has a rule with no conditions or more than one cookie"
+	errorCanaryStepsNotValid              = "Not a proper Canary object because CanaryAnalysis.Steps weights are not increasing between 1 and 100"
+	errorMetricsNotValid                  = "Not a proper Canary object because CanaryAnalysis.Metrics has metrics with no name or the same name"
+	errorMetricTemplateNotValid           = "Not a proper Canary object because a metric references a MetricTemplate that cannot be found or has an unknown provider, or has no known operator with valid bounds of its own or from the template"
+	errorBaselineNotValid                 = "Not a proper Canary object because a metric Baseline has a confidence not between 0 and 1, a negative window or step or an unknown direction"
+	errorMetricQueryNotValid              = "Not a proper Canary object because a metric has an unknown provider, reducer, multi-series or no data policy, an unknown operator or invalid bounds or a negative window, step, retries or minimum"
+	errorLoadTestNotValid                 = "Not a proper Canary object because CanaryAnalysis.LoadTest has an unknown mode, a path not starting with /, a rate not between 0 and 1000 or a negative duration"
+	errorHooksNotValid                    = "Not a proper Canary object because Hooks has hooks with no DNS label name, the same name, a negative timeout, a Job with no containers or an invalid URL or not exactly one of Job and URL"
+	errorHooksNotSupported                = "Not a proper Canary object because Hooks are only supported if Strategy is Canary"
+	errorApprovalNotValid                 = "Not a proper Canary object because Approval.Weights has weights not between 1 and 99"
+	errorApprovalNotSupported             = "Not a proper Canary object because Approval is only supported if Strategy is Canary"
+	errorWebhooksNotValid                 = "Not a proper Canary object because CanaryAnalysis.Webhooks has webhooks with no name, the same name, an invalid URL or a negative timeout or failure budget"
+	errorMetricsPolicyNotSupported        = "Not a proper Canary object because CanaryAnalysis.MetricsPolicy is not supported"
+	errorAutoDetectNotValid               = "Not a proper Canary object because AutoDetect needs TargetRef to be a Deployment and Strategy to be Canary"
+	errorMirrorNotSupported               = "Not a proper Canary object because Type or Strategy doesn't support mirroring traffic"
 	errorTargetRefNotValid                = "Not a proper Canary object because TargetRef points to an invalid object"
 	errorNotACanaryObject                 = "Not a Canary object"
 	errorCanaryObjectNotValid             = "Not a valid Canary object"
@@ -63,6 +88,21 @@ const (
 	errorQueryingMetricsServer            = "Error when querying the metrics server"
 	errorExtractingValueFromMetricsResult = "Error extracting metric value"
 	errorMountingMetricsURL               = "Error when mounting the metrics URL"
+	errorMetricsServerCredentials         = "Error when loading the credentials of the metrics server"
+	errorMetricTemplateNotFound           = "MetricTemplate object cannot be found"
+	errorWebhookCheckFailed               = "Error when calling a webhook check"
+	errorMetricNoData                     = "Metric query failed or returned no data"
+	errorStartingLoadTest                 = "Error when starting the load test"
+	errorHookFailed                       = "Hook failed"
+	errorReleaseNotInHistory              = "Release to rollback to is not in history or is the current one"
+	errorRollbackStrategyNotSupported     = "Rollback strategy is not supported, it must be Instant or Canary"
+	errorAutoDetectRollbackNotSupported   = "Rollback is not supported with AutoDetect, the pod template of TargetRef has to be reverted instead"
+	errorStoppingLoadTest                 = "Error when stopping the load test"
+	errorLoadTestServiceHasNoPorts        = "Canary service has no ports to send load to"
+	errorMetricOperatorNotValid           = "Metric operator or template provider is not supported or the bounds are not valid"
+	errorNoReleaseInHistoryToCompare      = "No release in history to compare the canary with"
+	errorTargetChangedBeforePromotion     = "Pod template of the target changed before the canary was promoted"
+	errorUnableToScaleTarget              = "Unable to scale the target"
 	errorNoReleaseInHistoryToRollback     = "No release in history to rollback"
 	errorUnableToUpdateInstance           = "Unable to update instance"
 	errorUnableToUpdateStatus             = "Unable to update status"
@@ -91,6 +131,7 @@ var (
 			"namespace",
 			"canary",
 			"target",
+			"metric",
 		})
 )
 
@@ -111,16 +152,6 @@ type DestinationServiceDef struct {
 	Weight int32
 }
 
-// TargetRouteDef collects data to create a Route
-type TargetRouteDef struct {
-	routeName      string
-	namespace      string
-	selector       map[string]string
-	targetPort     intstr.IntOrString
-	primaryService *DestinationServiceDef
-	canaryService  *DestinationServiceDef
-}
-
 // Add creates a new Canary Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -133,7 +164,7 @@ func newReconciler(mgr manager.Manager) reconcile.Reconciler {
 	oappsv1.AddToScheme(scheme)
 	routev1.AddToScheme(scheme)
 	// Best practices
-	return &ReconcileCanary{client: mgr.GetClient(), scheme: scheme, recorder: mgr.GetRecorder(controllerName)}
+	return &ReconcileCanary{client: mgr.GetClient(), scheme: scheme, recorder: mgr.GetRecorder(controllerName), loadTests: map[types.NamespacedName]context.CancelFunc{}}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -144,6 +175,38 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Only changes in the spec of Deployments, status changes with every pod
+	deploymentPredicate := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.MetaOld != nil && e.MetaNew != nil && e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration()
+		},
+	}
+
+	// Only hook Jobs that succeed or fail, the canary waits for them and load test Jobs don't change anything
+	hookJobPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldJob, ok := e.ObjectOld.(*batchv1.Job)
+			if !ok {
+				return false
+			}
+			newJob, ok := e.ObjectNew.(*batchv1.Job)
+			if !ok {
+				return false
+			}
+			if _, ok := newJob.Labels[hookLabel]; !ok {
+				return false
+			}
+
+			return oldJob.Status.Succeeded != newJob.Status.Succeeded || oldJob.Status.Failed != newJob.Status.Failed
+		},
+	}
+
 	predicate := predicate.Funcs{
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			// Check that new and old objects are the expected type
@@ -171,7 +234,9 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 				log.Error(nil, "Update event has no new metadata", "event", e)
 				return false
 			}
-			if e.MetaNew.GetGeneration() == e.MetaOld.GetGeneration() {
+			// Annotations don't change the generation but approve gates
+			if e.MetaNew.GetGeneration() == e.MetaOld.GetGeneration() &&
+				reflect.DeepEqual(e.MetaNew.GetAnnotations(), e.MetaOld.GetAnnotations()) {
 				return false
 			}
 
@@ -194,6 +259,25 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch for changes to Deployments and requeue the canaries watching them for new pod templates
+	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			return getCanariesForDeployment(mgr.GetClient(), obj)
+		}),
+	}, deploymentPredicate)
+	if err != nil {
+		return err
+	}
+
+	// Watch for hook Jobs and requeue the owner Canary as soon as they're done
+	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &kharonv1alpha1.Canary{},
+	}, hookJobPredicate)
+	if err != nil {
+		return err
+	}
+
 	// TODO(user): Modify this to be the types you create that are owned by the primary resource
 	// Watch for changes to secondary resource Pods and requeue the owner Canary
 	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForOwner{
@@ -218,6 +302,9 @@ type ReconcileCanary struct {
 	scheme *runtime.Scheme
 	// Best practices...
 	recorder record.EventRecorder
+	// Cancel functions of the in-process load tests running, by canary
+	loadTests     map[types.NamespacedName]context.CancelFunc
+	loadTestsLock sync.Mutex
 }
 
 // Reconcile reads that state of the cluster for a Canary object and makes changes based on the state read
@@ -245,6 +332,11 @@ func (r *ReconcileCanary) Reconcile(request reconcile.Request) (reconcile.Result
 		return reconcile.Result{}, err
 	}
 
+	// A canary watching TargetRef restores it before it's deleted along with the primary
+	if instance.DeletionTimestamp != nil && hasFinalizer(instance, targetFinalizer) {
+		return r.RestoreTarget(instance)
+	}
+
 	// Validate the CR instance
 	if ok, err := r.IsValid(instance); !ok {
 		return r.ManageError(instance, err)
@@ -292,6 +384,11 @@ func (r *ReconcileCanary) Reconcile(request reconcile.Request) (reconcile.Result
 		}
 	}
 
+	// If TargetRef is watched, releases come from changes in its pod template instead of TargetRef
+	if instance.Spec.AutoDetect {
+		return r.ReconcileAutoDetect(instance, target)
+	}
+
 	// If reentering from a canary rollback
 	if instance.Status.Status == kharonv1alpha1.CanaryConditionStatusFailure && instance.Status.Reason == errorRolledbackRelease {
 		// If target is already pointing to the previous release, we're fine
@@ -326,44 +423,149 @@ func (r *ReconcileCanary) Reconcile(request reconcile.Request) (reconcile.Result
 		if instance.Spec.TargetRef != instance.Status.ReleaseHistory[len(instance.Status.ReleaseHistory)-1].Ref {
 
 			// Then TargetRef is a Canary (a Canary IS already running OR starting)
-
-			// If Canary metric is not met, increase failedCheck counter
-			if metricValue, err := _metrics.ExecuteMetricQuery(instance); err == nil {
-				currentCanaryMetricValue.WithLabelValues(instance.Namespace, instance.Name, instance.Spec.TargetRef.Name).Set(metricValue)
-				instance.Status.CanaryMetricValue = metricValue
-				if !_metrics.ValidateMetricValue(metricValue, instance.Spec.CanaryAnalysis.Metric.Operator, instance.Spec.CanaryAnalysis.Metric.Threshold) {
-					instance.Status.FailedChecks++
+			return r.ReconcileCanaryRelease(instance)
+		} else {
+			// With no canary running, the only command is rolling back to a release in history
+			if command, err := r.TakeCommand(instance); err != nil {
+				return r.ManageError(instance, err)
+			} else if command != nil {
+				if command.Name == commandRollback {
+					return r.RollbackToRelease(instance, command)
 				}
-
-			} else {
-				log.Error(err, fmt.Sprintf("Error %s", err))
+				r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.UnknownCommand), "Canary release %s ignored command %s requested by %s while no canary is running", instance.ObjectMeta.Name, command.Name, command.RequestedBy)
 			}
 
-			// If failedCheck threshold is met, rollback
-			if instance.Status.FailedChecks > instance.Spec.CanaryAnalysis.Threshold {
+			// If TargetRef is the same ==> Action: No Action ==> it means reset status to zero (so to speak) if it's not zero
+			log.Info("ACTION {NO_ACTION}")
+			return r.ManageSuccess(instance, 0, kharonv1alpha1.NoAction)
+		}
+	}
+}
+
+// ReconcileCanaryRelease triggers the next action of the canary running
+func (r *ReconcileCanary) ReconcileCanaryRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
+	// Commands in the annotations of the canary come before anything else
+	if command, err := r.TakeCommand(instance); err != nil {
+		return r.ManageError(instance, err)
+	} else if command != nil {
+		switch command.Name {
+		case commandPromote:
+			return r.PromoteRelease(instance, command.RequestedBy)
+		case commandAbort:
+			return r.AbortRelease(instance, command.RequestedBy)
+		case commandSkipAnalysis:
+			r.SkipAnalysis(instance, command.RequestedBy)
+		default:
+			r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.UnknownCommand), "Canary release %s ignored command %s requested by %s while a canary is running", instance.ObjectMeta.Name, command.Name, command.RequestedBy)
+		}
+	}
+
+	// A canary promoted by command ends as soon as it can, it may be waiting for the primary to roll out
+	if instance.Status.Promoted {
+		return r.EndCanaryRelease(instance)
+	}
+
+	// In-process load doesn't survive a restart of the operator, so it's resumed for what's left of the step
+	if err := r.ResumeLoadTest(instance); err != nil {
+		log.Error(err, errorStartingLoadTest, "Canary.Name", instance.Name)
+	}
+
+	// If Canary metrics are not met, increase failedCheck counters and, if out of failure budget, rollback.
+	// A canary gets no traffic before its first step, so there's nothing to analyse until then
+	counted := true
+	if instance.Status.IsCanaryRunning && !instance.Status.SkipAnalysis {
+		var ok bool
+		if ok, counted = r.AnalyseCanaryRelease(instance); !ok {
+			return r.RollbackRelease(instance)
+		}
+	}
+
+	// A paused release holds at the current step
+	if instance.Spec.Paused {
+		return r.PauseRelease(instance)
+	} else if instance.Status.Phase == kharonv1alpha1.CanaryPhasePaused {
+		instance.Status.Phase = kharonv1alpha1.CanaryPhaseProgressing
+	}
+
+	// If it's been more than the interval beween Canary steps
+	timeSinceLastStep := time.Since(instance.Status.LastStepTime.Time)
+	if timeSinceLastStep > getStepInterval(instance) {
+		// Until every metric check counts, the canary holds its step instead of moving on unchecked
+		if !counted {
+			return r.AwaitSamples(instance)
+		}
+		// Blue/green releases are previewed and then switched in one step
+		if instance.Spec.Strategy == kharonv1alpha1.BlueGreenStrategy {
+			return r.ProgressBlueGreenRelease(instance)
+		}
+		// A/B tests send matching requests to the canary for a number of iterations
+		if instance.Spec.Strategy == kharonv1alpha1.ABTestingStrategy {
+			return r.ProgressABTestingRelease(instance)
+		}
+		// Pre-rollout hooks have to succeed before the canary gets any traffic
+		if !instance.Status.IsCanaryRunning {
+			if done, failed, err := r.RunHooks(instance, kharonv1alpha1.PreRolloutHook); err != nil {
+				return r.ManageError(instance, err)
+			} else if failed {
 				return r.RollbackRelease(instance)
+			} else if !done {
+				return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.RunHook)
 			}
-
-			// If it's been more than the interval beween Canary steps
-			timeSinceLastStep := time.Since(instance.Status.LastStepTime.Time)
-			if timeSinceLastStep > time.Duration(instance.Spec.CanaryAnalysis.Interval)*time.Second {
-				// If Progress is < 100 % ==> Action: Progress Canary Release
-				if instance.Status.CanaryWeight < 100 {
-					return r.ProgressCanaryRelease(instance)
+		}
+		// Before shifting any weight, traffic may be mirrored to the canary while it's analysed
+		if instance.Status.CanaryWeight <= 0 && instance.Status.MirrorIterations < instance.Spec.Mirror.Iterations {
+			return r.MirrorCanaryRelease(instance)
+		}
+		// If Progress is < 100 % ==> Action: Progress Canary Release (once rollout hooks of the step succeed)
+		if instance.Status.CanaryWeight < 100 {
+			if gate := getWeightGate(instance, getNextCanaryWeight(instance)); len(gate) > 0 {
+				if approved, err := r.IsApproved(instance, gate); err != nil {
+					return r.ManageError(instance, err)
+				} else if !approved {
+					return r.AwaitApproval(instance, gate)
 				}
-				// Else ==> Action: End Canary Release ==> Action Create Primary Release From Canary
-				return r.EndCanaryRelease(instance)
-			} else {
-				return r.ManageSuccess(instance, time.Duration(instance.Spec.CanaryAnalysis.Metric.Interval)*time.Second, kharonv1alpha1.RequeueEvent)
 			}
-		} else {
-			// If TargetRef is the same ==> Action: No Action ==> it means reset status to zero (so to speak) if it's not zero
-			log.Info("ACTION {NO_ACTION}")
-			return r.ManageSuccess(instance, 0, kharonv1alpha1.NoAction)
+			if done, failed, err := r.RunHooks(instance, kharonv1alpha1.RolloutHook); err != nil {
+				return r.ManageError(instance, err)
+			} else if failed {
+				return r.RollbackRelease(instance)
+			} else if !done {
+				return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.RunHook)
+			}
+			return r.ProgressCanaryRelease(instance)
 		}
+		// Else ==> Action: End Canary Release ==> Action Create Primary Release From Canary (once approved and pre-promotion hooks succeed)
+		if gate := getPromotionGate(instance); len(gate) > 0 {
+			if approved, err := r.IsApproved(instance, gate); err != nil {
+				return r.ManageError(instance, err)
+			} else if !approved {
+				return r.AwaitApproval(instance, gate)
+			}
+		}
+		if done, failed, err := r.RunHooks(instance, kharonv1alpha1.PrePromotionHook); err != nil {
+			return r.ManageError(instance, err)
+		} else if failed {
+			return r.RollbackRelease(instance)
+		} else if !done {
+			return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.RunHook)
+		}
+		return r.EndCanaryRelease(instance)
+	} else {
+		return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.RequeueEvent)
 	}
 }
 
+// AwaitSamples holds the canary at its current step while some metric check doesn't count, for lack of samples or data
+func (r *ReconcileCanary) AwaitSamples(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
+	log.Info("ACTION {AWAIT_SAMPLES}")
+	if instance.Status.LastAction != kharonv1alpha1.AwaitSamples {
+		// Send notification event
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.AwaitSamples), "Canary release %s of deployment %s holding at %d%% until every metric check has enough samples", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, instance.Status.CanaryWeight)
+	}
+
+	return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.AwaitSamples)
+}
+
 // CreatePrimaryRelease creates new release, hence no canary is triggered
 func (r *ReconcileCanary) CreatePrimaryRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
 	log.Info("ACTION {CREATE_PRIMARY_RELEASE}")
@@ -373,18 +575,18 @@ func (r *ReconcileCanary) CreatePrimaryRelease(instance *kharonv1alpha1.Canary)
 		return r.ManageError(instance, err)
 	}
 
-	// Create a Route that points to the targetService with no alternate service
+	// Create a Route (or whatever the router uses) that points to the targetService with no alternate service
 	primaryService := &DestinationServiceDef{
 		Name:   targetService.Name,
 		Weight: 100,
 	}
 	canaryService := &DestinationServiceDef{}
-	if route, err := r.CreateRouteForCanary(instance, primaryService, canaryService); err != nil {
-		if errors.IsAlreadyExists(err) {
-			if _, err := r.UpdateRouteDestinationsForCanary(route, primaryService, canaryService); err != nil {
-				return r.ManageError(instance, err)
-			}
-		}
+	router, err := NewRouterForCanary(instance, r.client, r.scheme)
+	if err != nil {
+		return r.ManageError(instance, err)
+	}
+	if err := router.CreateDestinations(instance, primaryService, canaryService); err != nil {
+		return r.ManageError(instance, err)
 	}
 
 	// Update Status with new Release!
@@ -410,29 +612,44 @@ func (r *ReconcileCanary) RollbackRelease(instance *kharonv1alpha1.Canary) (reco
 		return r.ManageError(instance, _util.NewError(errorNoReleaseInHistoryToRollback))
 	}
 
-	// Fetch route
-	route, err := r.FetchRoute(instance)
-	if err != nil {
-		log.Error(err, errorRouteNotFound)
-		return r.ManageError(instance, err)
-	}
-
 	// Route should point to current release (latest in history) with 100% Weight
 	primaryService := &DestinationServiceDef{
 		Name:   instance.Status.ReleaseHistory[len(instance.Status.ReleaseHistory)-1].Name,
 		Weight: 100,
 	}
 	canaryService := &DestinationServiceDef{}
-	if _, err := r.UpdateRouteDestinationsForCanary(route, primaryService, canaryService); err != nil {
+	if err := r.UpdateDestinationsForCanary(instance, primaryService, canaryService); err != nil {
+		return r.ManageError(instance, err)
+	}
+	if err := r.DeletePreviewForCanary(instance); err != nil {
 		return r.ManageError(instance, err)
 	}
+	if err := r.StopLoadTest(instance); err != nil {
+		log.Error(err, errorStoppingLoadTest, "Canary.Name", instance.Name)
+	}
+	r.TriggerHooks(instance, kharonv1alpha1.OnRollbackHook)
 
 	// Update Status with new Release!
 	instance.Status.IsCanaryRunning = false
 	instance.Status.CanaryWeight = 0
 	instance.Status.Iterations = 0
+	instance.Status.MirrorIterations = 0
 	instance.Status.FailedChecks = 0
-	instance.Status.CanaryMetricValue = 0
+	instance.Status.Metrics = nil
+	instance.Status.Webhooks = nil
+	instance.Status.Hooks = nil
+	instance.Status.Phase = ""
+	instance.Status.Approvals = nil
+	instance.Status.SkipAnalysis = false
+	instance.Status.Promoted = false
+
+	// If TargetRef is watched, it's scaled down and its pod template is not released again until it changes
+	if instance.Spec.AutoDetect {
+		if err := r.ScaleTarget(instance, 0); err != nil {
+			log.Error(err, errorUnableToScaleTarget, "Canary.Name", instance.Name)
+		}
+		instance.Status.Phase = kharonv1alpha1.CanaryPhaseFailed
+	}
 
 	// Send notification event
 	r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.RollbackReleaseStart), "Canary release rollback triggered for %s", instance.ObjectMeta.Name)
@@ -440,17 +657,6 @@ func (r *ReconcileCanary) RollbackRelease(instance *kharonv1alpha1.Canary) (reco
 	return r.ManageError(instance, _util.NewError(errorRolledbackRelease))
 }
 
-// FetchRoute get the route related to the canary object
-func (r *ReconcileCanary) FetchRoute(instance *kharonv1alpha1.Canary) (*routev1.Route, error) {
-	route := &routev1.Route{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, route)
-	if err != nil {
-		return nil, err
-	}
-
-	return route, nil
-}
-
 // ProgressCanaryRelease progresses the canary by updating its weight
 func (r *ReconcileCanary) ProgressCanaryRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
 	log.Info("ACTION {PROGRESS_CANARY_RELEASE}")
@@ -462,18 +668,7 @@ func (r *ReconcileCanary) ProgressCanaryRelease(instance *kharonv1alpha1.Canary)
 	}
 
 	// Let's calculate the next weight
-	canaryWeight := instance.Status.CanaryWeight + instance.Spec.CanaryAnalysis.StepWeight
-	// If new Canary weight is >= MaxWeigh, then set it to 100
-	if canaryWeight >= instance.Spec.CanaryAnalysis.MaxWeight {
-		canaryWeight = 100
-	}
-
-	// Fetch route
-	route, err := r.FetchRoute(instance)
-	if err != nil {
-		log.Error(err, errorRouteNotFound)
-		return r.ManageError(instance, err)
-	}
+	canaryWeight := getNextCanaryWeight(instance)
 
 	// Route should point to current release (latest in history) (100 - Canary Weight) and the TargetRef (Canary Weight)
 	primaryService := &DestinationServiceDef{
@@ -482,14 +677,20 @@ func (r *ReconcileCanary) ProgressCanaryRelease(instance *kharonv1alpha1.Canary)
 	}
 	canaryService := &DestinationServiceDef{
 		Name:   instance.Spec.TargetRef.Name,
-		Weight: instance.Status.CanaryWeight,
+		Weight: canaryWeight,
 	}
-	if _, err := r.UpdateRouteDestinationsForCanary(route, primaryService, canaryService); err != nil {
+	if err := r.UpdateDestinationsForCanary(instance, primaryService, canaryService); err != nil {
 		return r.ManageError(instance, err)
 	}
 
+	// Generate load against the canary so that metrics have samples, analysis goes on without it
+	if err := r.StartLoadTest(instance); err != nil {
+		log.Error(err, errorStartingLoadTest, "Canary.Name", instance.Name)
+	}
+
 	// Update Status with our progressed Canary
 	instance.Status.IsCanaryRunning = true
+	instance.Status.Phase = kharonv1alpha1.CanaryPhaseProgressing
 	instance.Status.CanaryWeight = canaryWeight
 	instance.Status.Iterations++
 	instance.Status.LastStepTime = metav1.Now()
@@ -499,48 +700,254 @@ func (r *ReconcileCanary) ProgressCanaryRelease(instance *kharonv1alpha1.Canary)
 	// Send notification event
 	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.ProgressCanaryRelease), "Canary release %s progressed deployment %s to %d%%", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, canaryWeight)
 
-	return r.ManageSuccess(instance, time.Duration(instance.Spec.CanaryAnalysis.Metric.Interval)*time.Second, kharonv1alpha1.ProgressCanaryRelease)
+	return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.ProgressCanaryRelease)
+}
+
+// MirrorCanaryRelease mirrors the traffic sent to the current release to the canary, responses from the canary
+// are discarded so no user is impacted while it's analysed
+func (r *ReconcileCanary) MirrorCanaryRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
+	log.Info("ACTION {MIRROR_CANARY_RELEASE}")
+	router, err := NewRouterForCanary(instance, r.client, r.scheme)
+	if err != nil {
+		return r.ManageError(instance, err)
+	}
+	mirrorRouter, ok := router.(MirrorRouter)
+	if !ok {
+		err := errors.NewBadRequest(errorMirrorNotSupported)
+		log.Error(err, errorMirrorNotSupported)
+		return r.ManageError(instance, err)
+	}
+
+	// Create a Service for TargetRef so that traffic can be mirrored to it
+	if _, err := r.CreateServiceForTargetRef(instance); err != nil && !errors.IsAlreadyExists(err) {
+		return r.ManageError(instance, err)
+	}
+
+	// Current release (latest in history) gets all the traffic and TargetRef a copy of it
+	primaryService := &DestinationServiceDef{
+		Name:   instance.Status.ReleaseHistory[len(instance.Status.ReleaseHistory)-1].Name,
+		Weight: 100,
+	}
+	canaryService := &DestinationServiceDef{
+		Name:   instance.Spec.TargetRef.Name,
+		Weight: 0,
+	}
+	if err := mirrorRouter.UpdateMirrorDestinations(instance, primaryService, canaryService); err != nil {
+		return r.ManageError(instance, err)
+	}
+
+	// Generate load against the canary so that metrics have samples, analysis goes on without it
+	if err := r.StartLoadTest(instance); err != nil {
+		log.Error(err, errorStartingLoadTest, "Canary.Name", instance.Name)
+	}
+
+	// Update Status with our mirrored Canary
+	instance.Status.IsCanaryRunning = true
+	instance.Status.Phase = kharonv1alpha1.CanaryPhaseProgressing
+	instance.Status.MirrorIterations++
+	instance.Status.LastStepTime = metav1.Now()
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.MirrorRelease), "Canary release %s mirroring traffic to deployment %s (iteration %d of %d)", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, instance.Status.MirrorIterations, instance.Spec.Mirror.Iterations)
+
+	return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.MirrorRelease)
+}
+
+// ProgressBlueGreenRelease previews the new release until enough analysis iterations have passed, then switches
+// all traffic to it and, once the rollback window is over, ends the release
+func (r *ReconcileCanary) ProgressBlueGreenRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
+	log.Info("ACTION {PROGRESS_BLUE_GREEN_RELEASE}")
+	// If traffic was already switched the release ends when the rollback window is over
+	if instance.Status.CanaryWeight >= 100 {
+		if time.Since(instance.Status.LastStepTime.Time) > time.Duration(instance.Spec.BlueGreen.RollbackWindow)*time.Second {
+			return r.EndCanaryRelease(instance)
+		}
+		return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.RequeueEvent)
+	}
+
+	router, err := NewRouterForCanary(instance, r.client, r.scheme)
+	if err != nil {
+		return r.ManageError(instance, err)
+	}
+	previewRouter, ok := router.(PreviewRouter)
+	if !ok {
+		err := errors.NewBadRequest(errorBlueGreenNotSupported)
+		log.Error(err, errorBlueGreenNotSupported)
+		return r.ManageError(instance, err)
+	}
+
+	// The new release is analysed through the preview with no production traffic
+	if instance.Status.Iterations < instance.Spec.BlueGreen.Iterations {
+		// Create a Service for TargetRef so that the preview can point to it
+		if _, err := r.CreateServiceForTargetRef(instance); err != nil && !errors.IsAlreadyExists(err) {
+			return r.ManageError(instance, err)
+		}
+		previewService := &DestinationServiceDef{
+			Name:   instance.Spec.TargetRef.Name,
+			Weight: 100,
+		}
+		if err := previewRouter.CreatePreview(instance, previewService); err != nil {
+			return r.ManageError(instance, err)
+		}
+
+		// The preview gets no production traffic, so load is what gives metrics samples
+		if err := r.StartLoadTest(instance); err != nil {
+			log.Error(err, errorStartingLoadTest, "Canary.Name", instance.Name)
+		}
+
+		// Update Status with our previewed release
+		instance.Status.IsCanaryRunning = true
+		instance.Status.Iterations++
+		instance.Status.LastStepTime = metav1.Now()
+
+		// Send notification event
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.PreviewRelease), "Blue/green release %s previewing deployment %s (iteration %d of %d)", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, instance.Status.Iterations, instance.Spec.BlueGreen.Iterations)
+
+		return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.PreviewRelease)
+	}
+
+	// Analysis went fine, so Route should point to TargetRef (Canary Weight 100) in one step
+	primaryService := &DestinationServiceDef{
+		Name:   instance.Spec.TargetRef.Name,
+		Weight: 100,
+	}
+	canaryService := &DestinationServiceDef{}
+	if err := router.UpdateDestinations(instance, primaryService, canaryService); err != nil {
+		return r.ManageError(instance, err)
+	}
+
+	// Update Status with our switched release, the rollback window starts now
+	instance.Status.CanaryWeight = 100
+	instance.Status.LastStepTime = metav1.Now()
+
+	currentCanaryWeight.WithLabelValues(instance.Namespace, instance.Name, instance.Spec.TargetRef.Name).Set(100)
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.SwitchRelease), "Blue/green release %s switched traffic to deployment %s", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name)
+
+	return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.SwitchRelease)
+}
+
+// ProgressABTestingRelease sends the requests matching the A/B testing rules to the canary until enough analysis
+// iterations have passed, then the canary is promoted
+func (r *ReconcileCanary) ProgressABTestingRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
+	log.Info("ACTION {PROGRESS_AB_TESTING_RELEASE}")
+	// If analysis went fine for long enough, the canary gets all the traffic
+	if instance.Status.Iterations >= instance.Spec.ABTesting.Iterations {
+		instance.Status.CanaryWeight = 100
+		return r.EndCanaryRelease(instance)
+	}
+
+	router, err := NewRouterForCanary(instance, r.client, r.scheme)
+	if err != nil {
+		return r.ManageError(instance, err)
+	}
+	matchRouter, ok := router.(MatchRouter)
+	if !ok {
+		err := errors.NewBadRequest(errorABTestingNotSupported)
+		log.Error(err, errorABTestingNotSupported)
+		return r.ManageError(instance, err)
+	}
+
+	// Create a Service for TargetRef so that matching requests can be routed to it
+	if _, err := r.CreateServiceForTargetRef(instance); err != nil && !errors.IsAlreadyExists(err) {
+		return r.ManageError(instance, err)
+	}
+
+	// Matching requests should go to TargetRef and the rest to current release (latest in history)
+	primaryService := &DestinationServiceDef{
+		Name:   instance.Status.ReleaseHistory[len(instance.Status.ReleaseHistory)-1].Name,
+		Weight: 100,
+	}
+	canaryService := &DestinationServiceDef{
+		Name:   instance.Spec.TargetRef.Name,
+		Weight: 0,
+	}
+	if err := matchRouter.UpdateMatchDestinations(instance, primaryService, canaryService, instance.Spec.ABTesting.Match); err != nil {
+		return r.ManageError(instance, err)
+	}
+
+	// Generate load against the canary so that metrics have samples, analysis goes on without it
+	if err := r.StartLoadTest(instance); err != nil {
+		log.Error(err, errorStartingLoadTest, "Canary.Name", instance.Name)
+	}
+
+	// Update Status with our progressed A/B test
+	instance.Status.IsCanaryRunning = true
+	instance.Status.Iterations++
+	instance.Status.LastStepTime = metav1.Now()
+
+	// Send notification event
+	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.ABTestingRelease), "A/B testing release %s routing matching requests to deployment %s (iteration %d of %d)", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name, instance.Status.Iterations, instance.Spec.ABTesting.Iterations)
+
+	return r.ManageSuccess(instance, getMetricsInterval(instance), kharonv1alpha1.ABTestingRelease)
 }
 
 // EndCanaryRelease ends the canary because everything went fine... so canary becomes primary
 func (r *ReconcileCanary) EndCanaryRelease(instance *kharonv1alpha1.Canary) (reconcile.Result, error) {
 	log.Info("ACTION {END_CANARY_RELEASE}")
-	// If Canary Weight is already < 100, then we produce a warning
-	if instance.Status.CanaryWeight < 100 {
+	// If Canary Weight is already < 100, then we produce a warning, unless the canary was promoted by command
+	if instance.Status.CanaryWeight < 100 && !instance.Status.Promoted {
 		err := errors.NewBadRequest(errorCanaryWeightNot100)
 		log.Error(err, errorCanaryWeightNot100)
 		return r.ManageError(instance, err)
 	}
 
-	// Fetch route
-	route, err := r.FetchRoute(instance)
-	if err != nil {
-		log.Error(err, errorRouteNotFound)
-		return r.ManageError(instance, err)
-	}
-
 	// Route should point to TargetRef (Canary Weight 100)
+	release := kharonv1alpha1.Release{
+		ID:   instance.Spec.TargetRef.Name,
+		Name: instance.Spec.TargetRef.Name,
+		Ref:  instance.Spec.TargetRef,
+	}
+	// Unless TargetRef is watched, then its pod template is promoted to the primary, which gets the traffic back
+	// once it rolled out, until then the canary keeps all the traffic
+	if instance.Spec.AutoDetect {
+		primaryRelease, primary, err := r.PromoteTargetToPrimary(instance)
+		if err != nil {
+			return r.ManageError(instance, err)
+		}
+		if !isRolledOut(primary) {
+			return r.AwaitPrimary(instance, primary)
+		}
+		release = *primaryRelease
+	}
 	primaryService := &DestinationServiceDef{
-		Name:   instance.Spec.TargetRef.Name,
+		Name:   release.Name,
 		Weight: 100,
 	}
 	canaryService := &DestinationServiceDef{}
-	if _, err := r.UpdateRouteDestinationsForCanary(route, primaryService, canaryService); err != nil {
+	if err := r.UpdateDestinationsForCanary(instance, primaryService, canaryService); err != nil {
+		return r.ManageError(instance, err)
+	}
+	if instance.Spec.AutoDetect {
+		if err := r.ScaleTarget(instance, 0); err != nil {
+			return r.ManageError(instance, err)
+		}
+		instance.Status.LastPromotedSpec = instance.Status.LastAppliedSpec
+	}
+	if err := r.DeletePreviewForCanary(instance); err != nil {
 		return r.ManageError(instance, err)
 	}
+	if err := r.StopLoadTest(instance); err != nil {
+		log.Error(err, errorStoppingLoadTest, "Canary.Name", instance.Name)
+	}
 
 	// Update Status with new primary
 	instance.Status.IsCanaryRunning = false
 	instance.Status.CanaryWeight = 0
-	instance.Status.CanaryMetricValue = 0
+	instance.Status.Metrics = nil
+	instance.Status.Webhooks = nil
+	instance.Status.Hooks = nil
+	instance.Status.Phase = ""
+	instance.Status.Approvals = nil
+	instance.Status.SkipAnalysis = false
+	instance.Status.Promoted = false
 	instance.Status.FailedChecks = 0
-	instance.Status.ReleaseHistory = append(instance.Status.ReleaseHistory, kharonv1alpha1.Release{
-		ID:   instance.Spec.TargetRef.Name,
-		Name: instance.Spec.TargetRef.Name,
-		Ref:  instance.Spec.TargetRef,
-	})
-	instance.Status.Iterations++
+	instance.Status.ReleaseHistory = append(instance.Status.ReleaseHistory, release)
+	instance.Status.Iterations = 0
+	instance.Status.MirrorIterations = 0
 	instance.Status.LastStepTime = metav1.Time{}
+	r.TriggerHooks(instance, kharonv1alpha1.PostPromotionHook)
 
 	// Send notification event
 	r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.EndCanaryRelease), "Canary release %s ended deployment %s with success", instance.ObjectMeta.Name, instance.Spec.TargetRef.Name)
@@ -550,9 +957,14 @@ func (r *ReconcileCanary) EndCanaryRelease(instance *kharonv1alpha1.Canary) (rec
 
 // CreateServiceForTargetRef creates a Service for Target
 func (r *ReconcileCanary) CreateServiceForTargetRef(instance *kharonv1alpha1.Canary) (*corev1.Service, error) {
-	// We have to check if there is a Service called as the TargetRef.Name, otherwise create it
+	return r.CreateService(instance, instance.Spec.TargetRef.Name, instance.Spec.TargetRefSelector)
+}
+
+// CreateService creates a Service with the given name and selector exposing the port of Target
+func (r *ReconcileCanary) CreateService(instance *kharonv1alpha1.Canary, name string, selector map[string]string) (*corev1.Service, error) {
+	// We have to check if there is a Service called as name, otherwise create it
 	targetService := &corev1.Service{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.TargetRef.Name, Namespace: instance.Namespace}, targetService)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, targetService)
 	if err != nil && errors.IsNotFound(err) {
 		portName := instance.Spec.TargetRefContainerPort.StrVal
 		if len(portName) <= 0 {
@@ -560,9 +972,9 @@ func (r *ReconcileCanary) CreateServiceForTargetRef(instance *kharonv1alpha1.Can
 		}
 		// The Service we need should be named as the Deployment because exposes the Deployment logic (as a canary)
 		targetServiceDef := &TargetServiceDef{
-			serviceName: instance.Spec.TargetRef.Name,
+			serviceName: name,
 			namespace:   instance.Namespace,
-			selector:    instance.Spec.TargetRefSelector,
+			selector:    selector,
 			portName:    portName,
 			protocol:    instance.Spec.TargetRefContainerProtocol,
 			port:        instance.Spec.TargetRefContainerPort.IntVal,
@@ -585,64 +997,33 @@ func (r *ReconcileCanary) CreateServiceForTargetRef(instance *kharonv1alpha1.Can
 	return targetService, nil
 }
 
-// CreateRouteForCanary creates a Route for Target
-func (r *ReconcileCanary) CreateRouteForCanary(instance *kharonv1alpha1.Canary,
+// UpdateDestinationsForCanary updates the destinations using the Router for the type of canary
+func (r *ReconcileCanary) UpdateDestinationsForCanary(instance *kharonv1alpha1.Canary,
 	primaryService *DestinationServiceDef,
-	canaryService *DestinationServiceDef) (*routev1.Route, error) {
-	// We have to check if there is a Route called canary.Spec.ServiceName, otherwise create it
-	targetRoute := &routev1.Route{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, targetRoute)
-	if err != nil && errors.IsNotFound(err) {
-		// There's no route, so we have to create it from a route definition object (TargetRouteDef)
-		// TargetRouteDef defines primary and canary services to route traffic to
-
-		// The Route we need should be named as the Deployment because exposes the Deployment logic (as a canary)
-		targetRouteDef := &TargetRouteDef{
-			routeName:      instance.Spec.ServiceName,
-			namespace:      instance.Namespace,
-			selector:       instance.Spec.TargetRefSelector,
-			targetPort:     instance.Spec.TargetRefContainerPort,
-			primaryService: primaryService,
-			canaryService:  canaryService,
-		}
-		targetRoute = newRouteFromTargetRouteDef(targetRouteDef)
-		// Set Canary instance as the owner and controller
-		if err := controllerutil.SetControllerReference(instance, targetRoute, r.scheme); err != nil {
-			return nil, err
-		}
-		log.Info("Creating the canary route", "CanaryService.Namespace", targetRoute.Namespace, "CanaryService.Name", targetRoute.Name)
-		err = r.client.Create(context.TODO(), targetRoute)
-		if err != nil && !errors.IsAlreadyExists(err) {
-			return nil, err
-		}
-		// No errors, so return created Route
-		return targetRoute, nil
-	} else if err != nil {
-		return nil, err
+	canaryService *DestinationServiceDef) error {
+	router, err := NewRouterForCanary(instance, r.client, r.scheme)
+	if err != nil {
+		return err
 	}
 
-	// Let's update the route
-	updateRouteDestinations(targetRoute, primaryService, canaryService)
-
-	return targetRoute, nil
+	return router.UpdateDestinations(instance, primaryService, canaryService)
 }
 
-// UpdateRouteDestinationsForCanary updates a Route with new destinations
-func (r *ReconcileCanary) UpdateRouteDestinationsForCanary(
-	route *routev1.Route,
-	primaryService *DestinationServiceDef,
-	canaryService *DestinationServiceDef) (*routev1.Route, error) {
-	if route == nil {
-		return nil, _util.NewError("No route to be updated")
+// DeletePreviewForCanary deletes the preview of a blue/green release, if any
+func (r *ReconcileCanary) DeletePreviewForCanary(instance *kharonv1alpha1.Canary) error {
+	if instance.Spec.Strategy != kharonv1alpha1.BlueGreenStrategy {
+		return nil
 	}
 
-	// Let's update the route
-	updateRouteDestinations(route, primaryService, canaryService)
-	if err := r.client.Update(context.TODO(), route); err != nil {
-		return nil, err
+	router, err := NewRouterForCanary(instance, r.client, r.scheme)
+	if err != nil {
+		return err
+	}
+	if previewRouter, ok := router.(PreviewRouter); ok {
+		return previewRouter.DeletePreview(instance)
 	}
 
-	return route, nil
+	return nil
 }
 
 // IsValid checks if our CR is valid or not
@@ -677,6 +1058,86 @@ func (r *ReconcileCanary) IsValid(obj metav1.Object) (bool, error) {
 		return false, err
 	}
 
+	// Check if Type is supported
+	router, err := NewRouterForCanary(canary, r.client, r.scheme)
+	if err != nil {
+		log.Error(err, errorCanaryTypeNotSupported)
+		return false, err
+	}
+
+	// Check if Strategy is supported by the router
+	switch canary.Spec.Strategy {
+	case kharonv1alpha1.CanaryStrategy, "":
+	case kharonv1alpha1.BlueGreenStrategy:
+		if _, ok := router.(PreviewRouter); !ok {
+			err := errors.NewBadRequest(errorBlueGreenNotSupported)
+			log.Error(err, errorBlueGreenNotSupported)
+			return false, err
+		}
+		if canary.Spec.BlueGreen.Iterations <= 0 {
+			err := errors.NewBadRequest(errorBlueGreenIterationsNotValid)
+			log.Error(err, errorBlueGreenIterationsNotValid)
+			return false, err
+		}
+	case kharonv1alpha1.ABTestingStrategy:
+		if _, ok := router.(MatchRouter); !ok {
+			err := errors.NewBadRequest(errorABTestingNotSupported)
+			log.Error(err, errorABTestingNotSupported)
+			return false, err
+		}
+		if !isValidMatch(canary.Spec.ABTesting.Match) {
+			err := errors.NewBadRequest(errorABTestingMatchNotValid)
+			log.Error(err, errorABTestingMatchNotValid)
+			return false, err
+		}
+		if canary.Spec.ABTesting.Iterations <= 0 {
+			err := errors.NewBadRequest(errorABTestingIterationsNotValid)
+			log.Error(err, errorABTestingIterationsNotValid)
+			return false, err
+		}
+	default:
+		err := errors.NewBadRequest(errorStrategyNotSupported)
+		log.Error(err, errorStrategyNotSupported)
+		return false, err
+	}
+
+	// Check if TargetRef can be watched for new pod templates
+	if !isValidAutoDetect(canary) {
+		err := errors.NewBadRequest(errorAutoDetectNotValid)
+		log.Error(err, errorAutoDetectNotValid)
+		return false, err
+	}
+
+	// Check if traffic can be mirrored, only weighted canaries have a mirroring phase
+	if canary.Spec.Mirror.Iterations > 0 {
+		if _, ok := router.(MirrorRouter); !ok || (canary.Spec.Strategy != kharonv1alpha1.CanaryStrategy && canary.Spec.Strategy != "") {
+			err := errors.NewBadRequest(errorMirrorNotSupported)
+			log.Error(err, errorMirrorNotSupported)
+			return false, err
+		}
+	}
+
+	// Check if there are Gateways to attach the HTTPRoute to
+	if canary.Spec.Type == kharonv1alpha1.GatewayAPI && len(canary.Spec.GatewayAPI.ParentRefs) <= 0 {
+		err := errors.NewBadRequest(errorGatewayAPIParentRefsEmpty)
+		log.Error(err, errorGatewayAPIParentRefsEmpty)
+		return false, err
+	}
+
+	// Check if there are replicas to share and a selector for the shared Service
+	if canary.Spec.Type == kharonv1alpha1.ReplicaRatio {
+		if canary.Spec.ReplicaRatio.Replicas < minReplicaRatioReplicas {
+			err := errors.NewBadRequest(errorReplicaRatioReplicasNotValid)
+			log.Error(err, errorReplicaRatioReplicasNotValid)
+			return false, err
+		}
+		if len(canary.Spec.ReplicaRatio.Selector) <= 0 {
+			err := errors.NewBadRequest(errorReplicaRatioSelectorEmpty)
+			log.Error(err, errorReplicaRatioSelectorEmpty)
+			return false, err
+		}
+	}
+
 	// Check if ServiceName is empty
 	if len(canary.Spec.ServiceName) <= 0 {
 		err := errors.NewBadRequest(errorServiceNameEmpty)
@@ -685,12 +1146,87 @@ func (r *ReconcileCanary) IsValid(obj metav1.Object) (bool, error) {
 	}
 
 	// Check if CanaryAnalysis is empty
-	if (kharonv1alpha1.CanaryAnalysis{}) == canary.Spec.CanaryAnalysis {
+	if reflect.DeepEqual(kharonv1alpha1.CanaryAnalysis{}, canary.Spec.CanaryAnalysis) {
 		err := errors.NewBadRequest(errorCanaryAnalysisEmpty)
 		log.Error(err, errorCanaryAnalysisEmpty)
 		return false, err
 	}
 
+	// Check if metrics can be told apart and how they're combined
+	if !isValidMetrics(canary.Spec.CanaryAnalysis.Metrics) {
+		err := errors.NewBadRequest(errorMetricsNotValid)
+		log.Error(err, errorMetricsNotValid)
+		return false, err
+	}
+	for _, metric := range _metrics.GetMetrics(canary) {
+		if !isValidMetricQuery(&metric) {
+			err := errors.NewBadRequest(errorMetricQueryNotValid)
+			log.Error(err, errorMetricQueryNotValid)
+			return false, err
+		}
+		// A template that cannot be fetched for another reason is retried, it's not the Canary that's wrong
+		metricTemplate, err := r.FetchMetricTemplate(canary, metric.TemplateRef)
+		if err != nil && !errors.IsNotFound(err) {
+			log.Error(err, errorMetricTemplateNotFound, "Metric.Name", metric.Name)
+			return false, err
+		}
+		if err != nil || !isValidMetricTemplate(&metric, metricTemplate) {
+			err := errors.NewBadRequest(errorMetricTemplateNotValid)
+			log.Error(err, errorMetricTemplateNotValid, "Metric.Name", metric.Name)
+			return false, err
+		}
+		if !isValidBaseline(metric.Baseline) {
+			err := errors.NewBadRequest(errorBaselineNotValid)
+			log.Error(err, errorBaselineNotValid)
+			return false, err
+		}
+	}
+	if !isValidWebhooks(canary.Spec.CanaryAnalysis.Webhooks) {
+		err := errors.NewBadRequest(errorWebhooksNotValid)
+		log.Error(err, errorWebhooksNotValid)
+		return false, err
+	}
+	if !isValidApproval(&canary.Spec.Approval) {
+		err := errors.NewBadRequest(errorApprovalNotValid)
+		log.Error(err, errorApprovalNotValid)
+		return false, err
+	}
+	if (len(canary.Spec.Approval.Weights) > 0 || canary.Spec.Approval.Promotion) &&
+		canary.Spec.Strategy != kharonv1alpha1.CanaryStrategy && canary.Spec.Strategy != "" {
+		err := errors.NewBadRequest(errorApprovalNotSupported)
+		log.Error(err, errorApprovalNotSupported)
+		return false, err
+	}
+	if !isValidHooks(&canary.Spec.Hooks) {
+		err := errors.NewBadRequest(errorHooksNotValid)
+		log.Error(err, errorHooksNotValid)
+		return false, err
+	}
+	if hasHooks(&canary.Spec.Hooks) && canary.Spec.Strategy != kharonv1alpha1.CanaryStrategy && canary.Spec.Strategy != "" {
+		err := errors.NewBadRequest(errorHooksNotSupported)
+		log.Error(err, errorHooksNotSupported)
+		return false, err
+	}
+	if !isValidLoadTest(canary.Spec.CanaryAnalysis.LoadTest) {
+		err := errors.NewBadRequest(errorLoadTestNotValid)
+		log.Error(err, errorLoadTestNotValid)
+		return false, err
+	}
+	switch canary.Spec.CanaryAnalysis.MetricsPolicy {
+	case kharonv1alpha1.MetricsPolicyAll, kharonv1alpha1.MetricsPolicyAny, "":
+	default:
+		err := errors.NewBadRequest(errorMetricsPolicyNotSupported)
+		log.Error(err, errorMetricsPolicyNotSupported)
+		return false, err
+	}
+
+	// Check if the step schedule can be walked
+	if !isValidSteps(canary.Spec.CanaryAnalysis.Steps) {
+		err := errors.NewBadRequest(errorCanaryStepsNotValid)
+		log.Error(err, errorCanaryStepsNotValid)
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -807,62 +1343,6 @@ func newServiceFromTargetServiceDef(targetServiceDef *TargetServiceDef) *corev1.
 	}
 }
 
-// Creates a Route given a ...
-func newRouteFromTargetRouteDef(targetRouteDef *TargetRouteDef) *routev1.Route {
-	annotations := map[string]string{
-		"openshift.io/generated-by": operatorName,
-	}
-	alternateBackends := []routev1.RouteTargetReference{}
-	if len(targetRouteDef.canaryService.Name) > 0 {
-		canaryWeight := 100 - targetRouteDef.primaryService.Weight
-		alternateBackends = []routev1.RouteTargetReference{routev1.RouteTargetReference{
-			Kind:   "Service",
-			Name:   targetRouteDef.canaryService.Name,
-			Weight: &canaryWeight,
-		}}
-	}
-	return &routev1.Route{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        targetRouteDef.routeName,
-			Namespace:   targetRouteDef.namespace,
-			Labels:      targetRouteDef.selector,
-			Annotations: annotations,
-		},
-		Spec: routev1.RouteSpec{
-			Port: &routev1.RoutePort{
-				TargetPort: targetRouteDef.targetPort,
-			},
-			To: routev1.RouteTargetReference{
-				Kind:   "Service",
-				Name:   targetRouteDef.primaryService.Name,
-				Weight: &targetRouteDef.primaryService.Weight,
-			},
-			AlternateBackends: alternateBackends,
-		},
-	}
-}
-
-// Updates destinations of route
-func updateRouteDestinations(route *routev1.Route,
-	primaryService *DestinationServiceDef,
-	canaryService *DestinationServiceDef) {
-	route.Spec.To = routev1.RouteTargetReference{
-		Kind:   "Service",
-		Name:   primaryService.Name,
-		Weight: &primaryService.Weight,
-	}
-	alternateBackends := []routev1.RouteTargetReference{}
-	if canaryService != nil && (DestinationServiceDef{}) != *canaryService {
-		canaryWeight := 100 - primaryService.Weight
-		alternateBackends = []routev1.RouteTargetReference{routev1.RouteTargetReference{
-			Kind:   "Service",
-			Name:   canaryService.Name,
-			Weight: &canaryWeight,
-		}}
-	}
-	route.Spec.AlternateBackends = alternateBackends
-}
-
 // IsInitialized checks if our CR has been initialized or not
 func (r *ReconcileCanary) IsInitialized(instance metav1.Object, target runtime.Object) (bool, error) {
 	canary, ok := instance.(*kharonv1alpha1.Canary)
@@ -939,6 +1419,65 @@ func (r *ReconcileCanary) IsInitialized(instance metav1.Object, target runtime.O
 	return false, nil
 }
 
+// Returns the weight after the current one, the next in Steps if there's a schedule, otherwise the current one
+// plus StepWeight. After the last step or MaxWeight the canary gets 100
+func getNextCanaryWeight(instance *kharonv1alpha1.Canary) int32 {
+	if len(instance.Spec.CanaryAnalysis.Steps) > 0 {
+		for _, step := range instance.Spec.CanaryAnalysis.Steps {
+			if step.Weight > instance.Status.CanaryWeight {
+				return step.Weight
+			}
+		}
+		return 100
+	}
+
+	canaryWeight := instance.Status.CanaryWeight + instance.Spec.CanaryAnalysis.StepWeight
+	// If new Canary weight is >= MaxWeigh, then set it to 100
+	if canaryWeight >= instance.Spec.CanaryAnalysis.MaxWeight {
+		canaryWeight = 100
+	}
+
+	return canaryWeight
+}
+
+// Returns how long the current weight holds, the Interval of its step if it overrides it, otherwise CanaryAnalysis.Interval
+func getStepInterval(instance *kharonv1alpha1.Canary) time.Duration {
+	for _, step := range instance.Spec.CanaryAnalysis.Steps {
+		if step.Weight == instance.Status.CanaryWeight && step.Interval > 0 {
+			return time.Duration(step.Interval) * time.Second
+		}
+	}
+
+	return time.Duration(instance.Spec.CanaryAnalysis.Interval) * time.Second
+}
+
+// Steps weights have to be strictly increasing and between 1 and 100
+func isValidSteps(steps []kharonv1alpha1.CanaryStep) bool {
+	lastWeight := int32(0)
+	for _, step := range steps {
+		if step.Weight <= lastWeight || step.Weight > 100 || step.Interval < 0 {
+			return false
+		}
+		lastWeight = step.Weight
+	}
+
+	return true
+}
+
+// Match rules need at least one condition and, as cookies are matched on the Cookie header, one cookie at most
+func isValidMatch(rules []kharonv1alpha1.MatchRule) bool {
+	if len(rules) <= 0 {
+		return false
+	}
+	for _, rule := range rules {
+		if len(rule.Headers)+len(rule.Cookies) <= 0 || len(rule.Cookies) > 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
 func findPortByName(name string, ports []corev1.ContainerPort) *corev1.ContainerPort {
 	for _, port := range ports {
 		if port.Name == name {
@@ -0,0 +1,67 @@
+package canary
+
+import (
+	"testing"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestIsValidRejectsStrategiesWithoutIterations(t *testing.T) {
+	match := []kharonv1alpha1.MatchRule{{Headers: []kharonv1alpha1.HeaderMatch{{Name: "x-canary", Value: "true"}}}}
+	tests := []struct {
+		name      string
+		strategy  kharonv1alpha1.StrategyType
+		blueGreen kharonv1alpha1.BlueGreenSpec
+		abTesting kharonv1alpha1.ABTestingSpec
+		err       string
+	}{
+		{"blue/green with iterations", kharonv1alpha1.BlueGreenStrategy, kharonv1alpha1.BlueGreenSpec{Iterations: 1}, kharonv1alpha1.ABTestingSpec{}, ""},
+		{"blue/green without iterations", kharonv1alpha1.BlueGreenStrategy, kharonv1alpha1.BlueGreenSpec{}, kharonv1alpha1.ABTestingSpec{}, errorBlueGreenIterationsNotValid},
+		{"blue/green with negative iterations", kharonv1alpha1.BlueGreenStrategy, kharonv1alpha1.BlueGreenSpec{Iterations: -1}, kharonv1alpha1.ABTestingSpec{}, errorBlueGreenIterationsNotValid},
+		{"A/B testing with iterations", kharonv1alpha1.ABTestingStrategy, kharonv1alpha1.BlueGreenSpec{}, kharonv1alpha1.ABTestingSpec{Iterations: 1, Match: match}, ""},
+		{"A/B testing without iterations", kharonv1alpha1.ABTestingStrategy, kharonv1alpha1.BlueGreenSpec{}, kharonv1alpha1.ABTestingSpec{Match: match}, errorABTestingIterationsNotValid},
+		{"A/B testing with negative iterations", kharonv1alpha1.ABTestingStrategy, kharonv1alpha1.BlueGreenSpec{}, kharonv1alpha1.ABTestingSpec{Iterations: -1, Match: match}, errorABTestingIterationsNotValid},
+		{"canary ignores blue/green and A/B testing", kharonv1alpha1.CanaryStrategy, kharonv1alpha1.BlueGreenSpec{}, kharonv1alpha1.ABTestingSpec{}, ""},
+	}
+	for _, test := range tests {
+		instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors"})
+		instance.Spec.Strategy = test.strategy
+		instance.Spec.BlueGreen = test.blueGreen
+		instance.Spec.ABTesting = test.abTesting
+		if test.strategy == kharonv1alpha1.ABTestingStrategy {
+			instance.Spec.Type = kharonv1alpha1.Istio
+		}
+		valid, err := newStubReconciler(nil).IsValid(instance)
+		if valid != (len(test.err) <= 0) {
+			t.Errorf("%s: IsValid = %t (%v), want %t", test.name, valid, err, len(test.err) <= 0)
+		}
+		if len(test.err) > 0 && (!errors.IsBadRequest(err) || err.Error() != test.err) {
+			t.Errorf("%s: IsValid failed with %v, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestIsValidRejectsReplicaRatioWithoutAReplicaForEach(t *testing.T) {
+	tests := []struct {
+		replicas int32
+		valid    bool
+	}{
+		{0, false},
+		{1, false},
+		{2, true},
+		{10, true},
+	}
+	for _, test := range tests {
+		instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors"})
+		instance.Spec.Type = kharonv1alpha1.ReplicaRatio
+		instance.Spec.ReplicaRatio = kharonv1alpha1.ReplicaRatioSpec{Replicas: test.replicas, Selector: map[string]string{"app": "app"}}
+		valid, err := newStubReconciler(nil).IsValid(instance)
+		if valid != test.valid {
+			t.Errorf("%d replicas: IsValid = %t (%v), want %t", test.replicas, valid, err, test.valid)
+		}
+		if !test.valid && (!errors.IsBadRequest(err) || err.Error() != errorReplicaRatioReplicasNotValid) {
+			t.Errorf("%d replicas: IsValid failed with %v, want %s", test.replicas, err, errorReplicaRatioReplicasNotValid)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strings"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	// Util
+	_webhooks "github.com/redhat/kharon-operator/pkg/util/webhooks"
+)
+
+// Label of the hook Jobs, its value is the name of the Canary
+const hookLabel = "kharon.redhat.com/hook"
+
+// Hook Job names are the canary and hook names, cut to fit in a label value, plus a hash of the release and step
+const maxHookJobNamePrefixLength = validation.DNS1123LabelMaxLength - 9
+
+// RunHooks runs the hooks of a type in order and returns true once all of them have succeeded. HTTP calls are made
+// in place, Jobs are created and checked again in later reconciles. It returns true as second value if a hook failed
+func (r *ReconcileCanary) RunHooks(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType) (bool, bool, error) {
+	hooks := getHooks(instance, hookType)
+	if len(hooks) <= 0 {
+		return true, false, nil
+	}
+
+	// Hook Jobs of previous releases are deleted before the first hook of a release
+	if len(instance.Status.Hooks) <= 0 {
+		if err := r.DeleteHookJobs(instance); err != nil {
+			return false, false, err
+		}
+	}
+
+	iteration := getHookIteration(instance, hookType)
+	for i := range hooks {
+		hook := &hooks[i]
+		hookStatus := getHookStatus(instance, hookType, hook.Name, iteration)
+		if hookStatus.Succeeded {
+			continue
+		}
+
+		var succeeded bool
+		if hook.Job != nil {
+			jobSucceeded, jobFailed, err := r.RunHookJob(instance, hookType, hook, iteration)
+			if err != nil {
+				return false, false, err
+			}
+			if jobFailed {
+				r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.RunHook), "Hook %s (%s) of canary release %s failed, its job %s failed", hook.Name, hookType, instance.ObjectMeta.Name, getHookJobName(instance, hookType, hook, iteration))
+				return false, true, nil
+			}
+			succeeded = jobSucceeded
+		} else {
+			if err := r.CallHook(instance, hookType, hook); err != nil {
+				log.Error(err, errorHookFailed, "Hook.Name", hook.Name, "Hook.Type", hookType)
+				r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.RunHook), "Hook %s (%s) of canary release %s failed: %s", hook.Name, hookType, instance.ObjectMeta.Name, err)
+				return false, true, nil
+			}
+			succeeded = true
+		}
+		if !succeeded {
+			return false, false, nil
+		}
+
+		hookStatus.Succeeded = true
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.RunHook), "Hook %s (%s) of canary release %s succeeded", hook.Name, hookType, instance.ObjectMeta.Name)
+	}
+
+	return true, false, nil
+}
+
+// TriggerHooks starts the hooks of a type without waiting for them, failures are only logged
+func (r *ReconcileCanary) TriggerHooks(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType) {
+	hooks := getHooks(instance, hookType)
+	iteration := getHookIteration(instance, hookType)
+	for i := range hooks {
+		hook := &hooks[i]
+		var err error
+		if hook.Job != nil {
+			_, _, err = r.RunHookJob(instance, hookType, hook, iteration)
+		} else {
+			err = r.CallHook(instance, hookType, hook)
+		}
+		if err != nil {
+			log.Error(err, errorHookFailed, "Hook.Name", hook.Name, "Hook.Type", hookType)
+			r.recorder.Eventf(instance, "Warning", string(kharonv1alpha1.RunHook), "Hook %s (%s) of canary release %s failed: %s", hook.Name, hookType, instance.ObjectMeta.Name, err)
+			continue
+		}
+		r.recorder.Eventf(instance, "Normal", string(kharonv1alpha1.RunHook), "Hook %s (%s) of canary release %s started", hook.Name, hookType, instance.ObjectMeta.Name)
+	}
+}
+
+// RunHookJob creates the Job of a hook if it doesn't exist yet and returns if it has succeeded or failed
+func (r *ReconcileCanary) RunHookJob(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType, hook *kharonv1alpha1.Hook, iteration int32) (bool, bool, error) {
+	name := getHookJobName(instance, hookType, hook, iteration)
+	job := &batchv1.Job{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, job)
+	if err != nil && errors.IsNotFound(err) {
+		job = newHookJob(instance, name, hookType, hook)
+		// Set Canary instance as the owner and controller
+		if err := controllerutil.SetControllerReference(instance, job, r.scheme); err != nil {
+			return false, false, err
+		}
+		log.Info("Creating the hook job", "Job.Namespace", job.Namespace, "Job.Name", job.Name, "Hook.Type", hookType)
+		if err := r.client.Create(context.TODO(), job); err != nil && !errors.IsAlreadyExists(err) {
+			return false, false, err
+		}
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, false, nil
+		case batchv1.JobFailed:
+			return false, true, nil
+		}
+	}
+
+	return false, false, nil
+}
+
+// CallHook POSTs the state of the canary to the URL of a hook
+func (r *ReconcileCanary) CallHook(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType, hook *kharonv1alpha1.Hook) error {
+	payload := &_webhooks.Payload{
+		Name:      instance.Name,
+		Namespace: instance.Namespace,
+		Target:    instance.Spec.TargetRef.Name,
+		Weight:    instance.Status.CanaryWeight,
+		Iteration: instance.Status.Iterations,
+		Hook:      string(hookType),
+	}
+	_, err := _webhooks.CallWebhook(context.TODO(), hook.URL, time.Duration(hook.Timeout)*time.Second, payload)
+
+	return err
+}
+
+// DeleteHookJobs deletes the hook Jobs of the canary
+func (r *ReconcileCanary) DeleteHookJobs(instance *kharonv1alpha1.Canary) error {
+	jobs := &batchv1.JobList{}
+	listOptions := client.MatchingLabels(map[string]string{hookLabel: instance.Name}).InNamespace(instance.Namespace)
+	if err := r.client.List(context.TODO(), listOptions, jobs); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		log.Info("Deleting the hook job", "Job.Namespace", jobs.Items[i].Namespace, "Job.Name", jobs.Items[i].Name)
+		err := r.client.Delete(context.TODO(), &jobs.Items[i], client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the hooks of a type
+func getHooks(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType) []kharonv1alpha1.Hook {
+	switch hookType {
+	case kharonv1alpha1.PreRolloutHook:
+		return instance.Spec.Hooks.PreRollout
+	case kharonv1alpha1.RolloutHook:
+		return instance.Spec.Hooks.Rollout
+	case kharonv1alpha1.PrePromotionHook:
+		return instance.Spec.Hooks.PrePromotion
+	case kharonv1alpha1.PostPromotionHook:
+		return instance.Spec.Hooks.PostPromotion
+	case kharonv1alpha1.OnRollbackHook:
+		return instance.Spec.Hooks.OnRollback
+	default:
+		return nil
+	}
+}
+
+// Returns the iteration hooks of a type run for, the current step for rollout hooks and 0 for the rest
+func getHookIteration(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType) int32 {
+	if hookType == kharonv1alpha1.RolloutHook {
+		return instance.Status.Iterations
+	}
+
+	return 0
+}
+
+// Returns the status of a hook, it's added to the status of the canary if it's not there yet
+func getHookStatus(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType, name string, iteration int32) *kharonv1alpha1.HookStatus {
+	for i := range instance.Status.Hooks {
+		hookStatus := &instance.Status.Hooks[i]
+		if hookStatus.Type == hookType && hookStatus.Name == name && hookStatus.Iteration == iteration {
+			return hookStatus
+		}
+	}
+	instance.Status.Hooks = append(instance.Status.Hooks, kharonv1alpha1.HookStatus{Name: name, Type: hookType, Iteration: iteration})
+
+	return &instance.Status.Hooks[len(instance.Status.Hooks)-1]
+}
+
+// Returns the name of the Job of a hook, the same for a release, hook type and iteration
+func getHookJobName(instance *kharonv1alpha1.Canary, hookType kharonv1alpha1.HookType, hook *kharonv1alpha1.Hook, iteration int32) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(fmt.Sprintf("%s/%d/%s/%d", instance.Spec.TargetRef.Name, len(instance.Status.ReleaseHistory), hookType, iteration)))
+	prefix := instance.Name + "-" + hook.Name
+	if len(prefix) > maxHookJobNamePrefixLength {
+		prefix = strings.TrimRight(prefix[:maxHookJobNamePrefixLength], "-")
+	}
+
+	return fmt.Sprintf("%s-%08x", prefix, hash.Sum32())
+}
+
+// Creates the Job of a hook out of its JobSpec
+func newHookJob(instance *kharonv1alpha1.Canary, name string, hookType kharonv1alpha1.HookType, hook *kharonv1alpha1.Hook) *batchv1.Job {
+	annotations := map[string]string{
+		"openshift.io/generated-by": operatorName,
+	}
+	labels := map[string]string{
+		hookLabel: instance.Name,
+	}
+	jobSpec := hook.Job.DeepCopy()
+	if len(jobSpec.Template.Spec.RestartPolicy) <= 0 {
+		jobSpec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   instance.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *jobSpec,
+	}
+}
+
+// Returns true if there's a hook of any type
+func hasHooks(hooks *kharonv1alpha1.HooksSpec) bool {
+	return len(hooks.PreRollout)+len(hooks.Rollout)+len(hooks.PrePromotion)+len(hooks.PostPromotion)+len(hooks.OnRollback) > 0
+}
+
+// Hooks need a unique DNS label as name and either a Job with containers or a URL
+func isValidHooks(hooks *kharonv1alpha1.HooksSpec) bool {
+	for _, hooksOfType := range [][]kharonv1alpha1.Hook{hooks.PreRollout, hooks.Rollout, hooks.PrePromotion, hooks.PostPromotion, hooks.OnRollback} {
+		names := map[string]bool{}
+		for _, hook := range hooksOfType {
+			if len(validation.IsDNS1123Label(hook.Name)) > 0 || names[hook.Name] || hook.Timeout < 0 {
+				return false
+			}
+			names[hook.Name] = true
+			if (hook.Job != nil) == (len(hook.URL) > 0) {
+				return false
+			}
+			if hook.Job != nil && len(hook.Job.Template.Spec.Containers) <= 0 {
+				return false
+			}
+			if hook.Job == nil {
+				if hookURL, err := url.Parse(hook.URL); err != nil || len(hookURL.Scheme) <= 0 || len(hookURL.Host) <= 0 {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,60 @@
+package canary
+
+import (
+	"testing"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestIsValidRejectsHooksUnlessCanaryStrategy(t *testing.T) {
+	hooks := kharonv1alpha1.HooksSpec{
+		PrePromotion: []kharonv1alpha1.Hook{{Name: "smoke-tests", URL: "http://smoke-tests:8080/run"}},
+	}
+
+	tests := []struct {
+		name     string
+		strategy kharonv1alpha1.StrategyType
+		hooks    kharonv1alpha1.HooksSpec
+		valid    bool
+	}{
+		{"canary with hooks", kharonv1alpha1.CanaryStrategy, hooks, true},
+		{"default strategy with hooks", "", hooks, true},
+		{"blue/green with hooks", kharonv1alpha1.BlueGreenStrategy, hooks, false},
+		{"blue/green with a postPromotion hook", kharonv1alpha1.BlueGreenStrategy,
+			kharonv1alpha1.HooksSpec{PostPromotion: []kharonv1alpha1.Hook{{Name: "notify", URL: "http://notify:8080"}}}, false},
+		{"blue/green without hooks", kharonv1alpha1.BlueGreenStrategy, kharonv1alpha1.HooksSpec{}, true},
+	}
+	for _, test := range tests {
+		instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{Name: "error-rate", Operator: "lt", Threshold: 1, PrometheusQuery: "errors"})
+		instance.Spec.Strategy = test.strategy
+		instance.Spec.BlueGreen = kharonv1alpha1.BlueGreenSpec{Iterations: 3, RollbackWindow: 60}
+		instance.Spec.Hooks = test.hooks
+		valid, err := newStubReconciler(nil).IsValid(instance)
+		if valid != test.valid {
+			t.Errorf("%s: IsValid = %t (%v), want %t", test.name, valid, err, test.valid)
+		}
+		if !test.valid && (!errors.IsBadRequest(err) || err.Error() != errorHooksNotSupported) {
+			t.Errorf("%s: IsValid failed with %v, want %s", test.name, err, errorHooksNotSupported)
+		}
+	}
+}
+
+func TestHookJobsAreWaitedFor(t *testing.T) {
+	job := &batchv1.JobSpec{}
+	job.Template.Spec.Containers = []corev1.Container{{Name: "smoke-tests", Image: "smoke-tests"}}
+	instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{})
+	instance.Spec.CanaryAnalysis.Interval = 0
+	instance.Status.SkipAnalysis = true
+	instance.Spec.Hooks.PrePromotion = []kharonv1alpha1.Hook{{Name: "smoke-tests", Job: job}}
+
+	result, err := newStubReconciler(nil).ReconcileCanaryRelease(instance)
+	if err != nil {
+		t.Fatalf("ReconcileCanaryRelease failed: %v", err)
+	}
+	if instance.Status.LastAction != kharonv1alpha1.RunHook || result.RequeueAfter <= 0 {
+		t.Errorf("Last action %s, requeue after %s, want %s with a requeue", instance.Status.LastAction, result.RequeueAfter, kharonv1alpha1.RunHook)
+	}
+}
@@ -0,0 +1,215 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+	_loadtest "github.com/redhat/kharon-operator/pkg/util/loadtest"
+)
+
+// Label of the load test Jobs, its value is the name of the Canary
+const loadTestLabel = "kharon.redhat.com/load-test"
+
+const (
+	defaultLoadTestRequestsPerSecond = 10
+	defaultLoadTestImage             = "registry.access.redhat.com/ubi8/ubi-minimal"
+	// Highest rate a load test may request, above it the interval between requests rounds down to 0
+	maxLoadTestRequestsPerSecond = 1000
+	// Seconds a load test Job may run beyond its duration before it's killed
+	loadTestJobGracePeriod = 30
+)
+
+// Sends $RPS requests to $URL every second for $DURATION seconds
+const loadTestJobScript = `end=$(( $(date +%s) + $DURATION )); ` +
+	`while [ $(date +%s) -lt $end ]; do ` +
+	`i=0; while [ $i -lt $RPS ]; do curl -s -o /dev/null -X "$METHOD" "$URL" & i=$((i+1)); done; ` +
+	`sleep 1; ` +
+	`done; wait`
+
+// StartLoadTest stops the load test of the previous step, if any, and starts generating load against the canary
+// Service as a Job owned by the canary or in the operator, depending on LoadTest.Mode
+func (r *ReconcileCanary) StartLoadTest(instance *kharonv1alpha1.Canary) error {
+	if instance.Spec.CanaryAnalysis.LoadTest == nil {
+		return nil
+	}
+	if err := r.StopLoadTest(instance); err != nil {
+		return err
+	}
+
+	return r.runLoadTest(instance, 0)
+}
+
+// ResumeLoadTest starts again, for what's left of the step, an in-process load test lost because the operator
+// restarted. Jobs survive restarts so they're left alone
+func (r *ReconcileCanary) ResumeLoadTest(instance *kharonv1alpha1.Canary) error {
+	loadTest := instance.Spec.CanaryAnalysis.LoadTest
+	if loadTest == nil || loadTest.Mode != kharonv1alpha1.LoadTestInProcess || !instance.Status.IsCanaryRunning {
+		return nil
+	}
+	r.loadTestsLock.Lock()
+	_, running := r.loadTests[types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}]
+	r.loadTestsLock.Unlock()
+	elapsed := time.Since(instance.Status.LastStepTime.Time)
+	if running || elapsed >= getLoadTestDuration(instance) {
+		return nil
+	}
+
+	return r.runLoadTest(instance, elapsed)
+}
+
+// Generates load against the canary Service for the duration of the load test but elapsed
+func (r *ReconcileCanary) runLoadTest(instance *kharonv1alpha1.Canary, elapsed time.Duration) error {
+	loadTest := instance.Spec.CanaryAnalysis.LoadTest
+
+	// The canary Service is the target of the load
+	targetService, err := r.CreateServiceForTargetRef(instance)
+	if err != nil && errors.IsAlreadyExists(err) {
+		targetService = &corev1.Service{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.TargetRef.Name, Namespace: instance.Namespace}, targetService)
+	}
+	if err != nil {
+		return err
+	}
+	if len(targetService.Spec.Ports) <= 0 {
+		return fmt.Errorf("%s: %s", errorLoadTestServiceHasNoPorts, targetService.Name)
+	}
+	url := fmt.Sprintf("http://%s.%s.svc:%d%s", targetService.Name, targetService.Namespace, targetService.Spec.Ports[0].Port, _util.NVL(loadTest.Path, "/"))
+	method := _util.NVL(loadTest.Method, http.MethodGet)
+	requestsPerSecond := loadTest.RequestsPerSecond
+	if requestsPerSecond <= 0 {
+		requestsPerSecond = defaultLoadTestRequestsPerSecond
+	}
+	duration := getLoadTestDuration(instance) - elapsed
+
+	if loadTest.Mode == kharonv1alpha1.LoadTestInProcess {
+		ctx, cancel := context.WithCancel(context.Background())
+		r.loadTestsLock.Lock()
+		r.loadTests[types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}] = cancel
+		r.loadTestsLock.Unlock()
+		log.Info("Starting the in-process load test", "Canary.Name", instance.Name, "URL", url)
+		go _loadtest.Run(ctx, method, url, requestsPerSecond, duration)
+		return nil
+	}
+
+	job := newLoadTestJob(instance, loadTest, method, url, requestsPerSecond, duration)
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, job, r.scheme); err != nil {
+		return err
+	}
+	log.Info("Creating the load test job", "Job.Namespace", job.Namespace, "Job.GenerateName", job.GenerateName, "URL", url)
+	return r.client.Create(context.TODO(), job)
+}
+
+// StopLoadTest cancels the in-process load test of the canary and deletes its load test Jobs, if any
+func (r *ReconcileCanary) StopLoadTest(instance *kharonv1alpha1.Canary) error {
+	key := types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}
+	r.loadTestsLock.Lock()
+	if cancel, ok := r.loadTests[key]; ok {
+		cancel()
+		delete(r.loadTests, key)
+	}
+	r.loadTestsLock.Unlock()
+
+	jobs := &batchv1.JobList{}
+	listOptions := client.MatchingLabels(map[string]string{loadTestLabel: instance.Name}).InNamespace(instance.Namespace)
+	if err := r.client.List(context.TODO(), listOptions, jobs); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		log.Info("Deleting the load test job", "Job.Namespace", jobs.Items[i].Namespace, "Job.Name", jobs.Items[i].Name)
+		err := r.client.Delete(context.TODO(), &jobs.Items[i], client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the duration of the load test, LoadTest.Duration or, if not set, the step interval
+func getLoadTestDuration(instance *kharonv1alpha1.Canary) time.Duration {
+	if duration := time.Duration(instance.Spec.CanaryAnalysis.LoadTest.Duration) * time.Second; duration > 0 {
+		return duration
+	}
+
+	return getStepInterval(instance)
+}
+
+// Load tests need a known mode, a path starting with /, a rate between 0 and maxLoadTestRequestsPerSecond and no
+// negative duration
+func isValidLoadTest(loadTest *kharonv1alpha1.LoadTestSpec) bool {
+	if loadTest == nil {
+		return true
+	}
+	if loadTest.RequestsPerSecond < 0 || loadTest.RequestsPerSecond > maxLoadTestRequestsPerSecond || loadTest.Duration < 0 || (len(loadTest.Path) > 0 && !strings.HasPrefix(loadTest.Path, "/")) {
+		return false
+	}
+	switch loadTest.Mode {
+	case kharonv1alpha1.LoadTestJob, kharonv1alpha1.LoadTestInProcess, "":
+		return true
+	default:
+		return false
+	}
+}
+
+// Creates a Job that sends requestsPerSecond requests to url for duration, its name is generated as there's one per step
+func newLoadTestJob(instance *kharonv1alpha1.Canary, loadTest *kharonv1alpha1.LoadTestSpec, method string, url string, requestsPerSecond int32, duration time.Duration) *batchv1.Job {
+	annotations := map[string]string{
+		"openshift.io/generated-by": operatorName,
+	}
+	labels := map[string]string{
+		loadTestLabel: instance.Name,
+	}
+	backoffLimit := int32(0)
+	activeDeadlineSeconds := int64(duration.Seconds()) + loadTestJobGracePeriod
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: instance.Name + "-load-",
+			Namespace:    instance.Namespace,
+			Labels:       labels,
+			Annotations:  annotations,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &activeDeadlineSeconds,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: annotations,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:            "load",
+							Image:           _util.NVL(loadTest.Image, defaultLoadTestImage),
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Command:         []string{"sh", "-c", loadTestJobScript},
+							Env: []corev1.EnvVar{
+								{Name: "URL", Value: url},
+								{Name: "METHOD", Value: method},
+								{Name: "RPS", Value: strconv.Itoa(int(requestsPerSecond))},
+								{Name: "DURATION", Value: strconv.Itoa(int(duration.Seconds()))},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
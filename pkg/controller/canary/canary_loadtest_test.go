@@ -0,0 +1,70 @@
+package canary
+
+import (
+	"context"
+	"testing"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// createdJobsClient is a stubClient keeping the Jobs it's asked to create
+type createdJobsClient struct {
+	*stubClient
+	jobs []*batchv1.Job
+}
+
+func (c *createdJobsClient) Create(ctx context.Context, obj runtime.Object) error {
+	if job, ok := obj.(*batchv1.Job); ok {
+		c.jobs = append(c.jobs, job)
+	}
+
+	return nil
+}
+
+func TestIsValidLoadTestBoundsTheRate(t *testing.T) {
+	tests := []struct {
+		requestsPerSecond int32
+		valid             bool
+	}{
+		{-1, false},
+		{0, true},
+		{10, true},
+		{maxLoadTestRequestsPerSecond, true},
+		{maxLoadTestRequestsPerSecond + 1, false},
+		{2000000000, false},
+	}
+	for _, test := range tests {
+		loadTest := &kharonv1alpha1.LoadTestSpec{Mode: kharonv1alpha1.LoadTestJob, RequestsPerSecond: test.requestsPerSecond}
+		if valid := isValidLoadTest(loadTest); valid != test.valid {
+			t.Errorf("isValidLoadTest with %d requests per second = %t, want %t", test.requestsPerSecond, valid, test.valid)
+		}
+	}
+}
+
+func TestLoadTestTargetsTheExistingService(t *testing.T) {
+	instance := newCanaryAtFullWeight("http://prometheus:9090", kharonv1alpha1.Metric{})
+	instance.Spec.CanaryAnalysis.LoadTest = &kharonv1alpha1.LoadTestSpec{Mode: kharonv1alpha1.LoadTestJob, Path: "/api/greeting"}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-v2", Namespace: "test"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 9000}}},
+	}
+	r := newStubReconciler(map[types.NamespacedName]runtime.Object{{Name: "app-v2", Namespace: "test"}: service})
+	client := &createdJobsClient{stubClient: r.client.(*stubClient)}
+	r.client = client
+
+	if err := r.StartLoadTest(instance); err != nil {
+		t.Fatalf("StartLoadTest failed: %v", err)
+	}
+	if len(client.jobs) != 1 {
+		t.Fatalf("%d load test jobs created, want 1", len(client.jobs))
+	}
+	url := client.jobs[0].Spec.Template.Spec.Containers[0].Env[0].Value
+	if url != "http://app-v2.test.svc:9000/api/greeting" {
+		t.Errorf("Load test URL %s, want the port of the existing service", url)
+	}
+}
@@ -0,0 +1,104 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+)
+
+const (
+	errorCanaryTypeNotSupported = "Not a proper Canary object because Type is not supported"
+	errorServiceHasNoPorts      = "Service has no ports to route traffic to"
+)
+
+// Router shifts traffic between the primary and the canary releases, each provider (Route, VirtualService...)
+// implements it using its own objects
+type Router interface {
+	// CreateDestinations creates the objects needed to route traffic to primary and canary, if they
+	// already exist their destinations are updated
+	CreateDestinations(instance *kharonv1alpha1.Canary, primaryService *DestinationServiceDef, canaryService *DestinationServiceDef) error
+	// UpdateDestinations updates the destinations of the objects routing traffic to primary and canary,
+	// the objects must exist
+	UpdateDestinations(instance *kharonv1alpha1.Canary, primaryService *DestinationServiceDef, canaryService *DestinationServiceDef) error
+}
+
+// PreviewRouter is implemented by routers able to expose a release through a preview object that receives
+// no production traffic, so that it can be analysed before switching traffic to it
+type PreviewRouter interface {
+	// CreatePreview creates (or updates) the preview object sending all its traffic to previewService
+	CreatePreview(instance *kharonv1alpha1.Canary, previewService *DestinationServiceDef) error
+	// DeletePreview deletes the preview object if it exists
+	DeletePreview(instance *kharonv1alpha1.Canary) error
+}
+
+// MatchRouter is implemented by routers able to send the requests matching some rules to the canary
+type MatchRouter interface {
+	// UpdateMatchDestinations sends the requests matching any of the rules to canaryService and the rest
+	// to primaryService, the objects routing traffic must exist
+	UpdateMatchDestinations(instance *kharonv1alpha1.Canary, primaryService *DestinationServiceDef, canaryService *DestinationServiceDef, rules []kharonv1alpha1.MatchRule) error
+}
+
+// MirrorRouter is implemented by routers able to mirror traffic to the canary, responses from the canary are discarded
+type MirrorRouter interface {
+	// UpdateMirrorDestinations sends all the traffic to primaryService and mirrors it to canaryService,
+	// the objects routing traffic must exist
+	UpdateMirrorDestinations(instance *kharonv1alpha1.Canary, primaryService *DestinationServiceDef, canaryService *DestinationServiceDef) error
+}
+
+// NewRouterForCanary returns the Router for the type of the Canary object
+func NewRouterForCanary(instance *kharonv1alpha1.Canary, client client.Client, scheme *runtime.Scheme) (Router, error) {
+	switch instance.Spec.Type {
+	case kharonv1alpha1.Native, "":
+		return &RouteRouter{client: client, scheme: scheme}, nil
+	case kharonv1alpha1.Istio:
+		return &IstioRouter{client: client, scheme: scheme}, nil
+	case kharonv1alpha1.GatewayAPI:
+		return &GatewayAPIRouter{client: client, scheme: scheme}, nil
+	case kharonv1alpha1.NginxIngress:
+		return &NginxIngressRouter{client: client, scheme: scheme}, nil
+	case kharonv1alpha1.SMI:
+		return &SMIRouter{client: client, scheme: scheme}, nil
+	case kharonv1alpha1.ReplicaRatio:
+		return &ReplicaRatioRouter{client: client, scheme: scheme}, nil
+	default:
+		return nil, errors.NewBadRequest(fmt.Sprintf("%s: %s", errorCanaryTypeNotSupported, instance.Spec.Type))
+	}
+}
+
+// Converts a slice of strings into a slice that can be set in an unstructured object
+func toInterfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+
+	return result
+}
+
+// Returns the first port of a Service, that's the port routers send traffic to
+func getServicePort(c client.Client, namespace string, serviceName string) (int32, error) {
+	service := &corev1.Service{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: serviceName, Namespace: namespace}, service); err != nil {
+		return 0, err
+	}
+	if len(service.Spec.Ports) <= 0 {
+		return 0, _util.NewError(errorServiceHasNoPorts)
+	}
+
+	return service.Spec.Ports[0].Port, nil
+}
+
+// Returns a regular expression matching the Cookie header when it contains the cookie
+func getCookieRegex(cookie kharonv1alpha1.CookieMatch) string {
+	return fmt.Sprintf("^(.*?;\\s*)?(%s=%s)(;.*)?$", regexp.QuoteMeta(cookie.Name), regexp.QuoteMeta(cookie.Value))
+}
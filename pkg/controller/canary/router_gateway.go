@@ -0,0 +1,335 @@
+package canary
+
+import (
+	"context"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+)
+
+const (
+	errorHTTPRouteNotFound = "HTTPRoute object was deleted or cannot be found"
+)
+
+// Gateway API objects are handled as unstructured so that we don't depend on the Gateway API
+var httpRouteGVK = schema.GroupVersionKind{
+	Group:   "gateway.networking.k8s.io",
+	Version: "v1beta1",
+	Kind:    "HTTPRoute",
+}
+
+// TargetHTTPRouteDef collects data to create an HTTPRoute
+type TargetHTTPRouteDef struct {
+	httpRouteName string
+	namespace     string
+	selector      map[string]string
+	parentRefs    []kharonv1alpha1.ParentRef
+	hostnames     []string
+}
+
+// blank assignment to verify that GatewayAPIRouter implements Router, MatchRouter and MirrorRouter
+var _ Router = &GatewayAPIRouter{}
+var _ MatchRouter = &GatewayAPIRouter{}
+var _ MirrorRouter = &GatewayAPIRouter{}
+
+// GatewayAPIRouter routes traffic using a Gateway API HTTPRoute with weighted backendRefs
+type GatewayAPIRouter struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// CreateDestinations creates an HTTPRoute for the canary or updates it if it already exists
+func (r *GatewayAPIRouter) CreateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// We have to check if there is an HTTPRoute called canary.Spec.ServiceName, otherwise create it
+	httpRoute, err := r.FetchHTTPRoute(instance)
+	if err != nil && errors.IsNotFound(err) {
+		_, err = r.CreateHTTPRouteForCanary(instance, primaryService, canaryService)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	_, err = r.UpdateHTTPRouteDestinationsForCanary(httpRoute, primaryService, canaryService)
+	return err
+}
+
+// UpdateDestinations fetches the HTTPRoute of the canary and updates its destinations
+func (r *GatewayAPIRouter) UpdateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// Fetch http route
+	httpRoute, err := r.FetchHTTPRoute(instance)
+	if err != nil {
+		log.Error(err, errorHTTPRouteNotFound)
+		return err
+	}
+
+	_, err = r.UpdateHTTPRouteDestinationsForCanary(httpRoute, primaryService, canaryService)
+	return err
+}
+
+// UpdateMatchDestinations fetches the HTTPRoute of the canary and routes the requests matching the rules to the canary
+func (r *GatewayAPIRouter) UpdateMatchDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef,
+	rules []kharonv1alpha1.MatchRule) error {
+	// Fetch http route
+	httpRoute, err := r.FetchHTTPRoute(instance)
+	if err != nil {
+		log.Error(err, errorHTTPRouteNotFound)
+		return err
+	}
+
+	// Let's update the http route
+	if err := r.setHTTPRouteMatchDestinations(httpRoute, primaryService, canaryService, rules); err != nil {
+		return err
+	}
+
+	return r.client.Update(context.TODO(), httpRoute)
+}
+
+// UpdateMirrorDestinations fetches the HTTPRoute of the canary and mirrors the traffic sent to primary to the canary
+func (r *GatewayAPIRouter) UpdateMirrorDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// Fetch http route
+	httpRoute, err := r.FetchHTTPRoute(instance)
+	if err != nil {
+		log.Error(err, errorHTTPRouteNotFound)
+		return err
+	}
+
+	// Let's update the http route
+	if err := r.setHTTPRouteMirrorDestinations(httpRoute, primaryService, canaryService); err != nil {
+		return err
+	}
+
+	return r.client.Update(context.TODO(), httpRoute)
+}
+
+// FetchHTTPRoute get the http route related to the canary object
+func (r *GatewayAPIRouter) FetchHTTPRoute(instance *kharonv1alpha1.Canary) (*unstructured.Unstructured, error) {
+	httpRoute := &unstructured.Unstructured{}
+	httpRoute.SetGroupVersionKind(httpRouteGVK)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, httpRoute)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpRoute, nil
+}
+
+// CreateHTTPRouteForCanary creates an HTTPRoute for Target
+func (r *GatewayAPIRouter) CreateHTTPRouteForCanary(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	targetHTTPRouteDef := &TargetHTTPRouteDef{
+		httpRouteName: instance.Spec.ServiceName,
+		namespace:     instance.Namespace,
+		selector:      instance.Spec.TargetRefSelector,
+		parentRefs:    instance.Spec.GatewayAPI.ParentRefs,
+		hostnames:     instance.Spec.GatewayAPI.Hostnames,
+	}
+	httpRoute := newHTTPRouteFromTargetHTTPRouteDef(targetHTTPRouteDef)
+	if err := r.setHTTPRouteDestinations(httpRoute, primaryService, canaryService); err != nil {
+		return nil, err
+	}
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, httpRoute, r.scheme); err != nil {
+		return nil, err
+	}
+	log.Info("Creating the canary http route", "HTTPRoute.Namespace", httpRoute.GetNamespace(), "HTTPRoute.Name", httpRoute.GetName())
+	err := r.client.Create(context.TODO(), httpRoute)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	return httpRoute, nil
+}
+
+// UpdateHTTPRouteDestinationsForCanary updates an HTTPRoute with new destinations
+func (r *GatewayAPIRouter) UpdateHTTPRouteDestinationsForCanary(
+	httpRoute *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	if httpRoute == nil {
+		return nil, _util.NewError("No http route to be updated")
+	}
+
+	// Let's update the http route
+	if err := r.setHTTPRouteDestinations(httpRoute, primaryService, canaryService); err != nil {
+		return nil, err
+	}
+	if err := r.client.Update(context.TODO(), httpRoute); err != nil {
+		return nil, err
+	}
+
+	return httpRoute, nil
+}
+
+// Sets the rules of an http route so that traffic is split between primary and canary
+func (r *GatewayAPIRouter) setHTTPRouteDestinations(httpRoute *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	primaryBackendRef, err := r.newHTTPRouteBackendRef(httpRoute.GetNamespace(), primaryService.Name, int64(primaryService.Weight))
+	if err != nil {
+		return err
+	}
+	backendRefs := []interface{}{primaryBackendRef}
+	if canaryService != nil && (DestinationServiceDef{}) != *canaryService {
+		canaryWeight := 100 - primaryService.Weight
+		canaryBackendRef, err := r.newHTTPRouteBackendRef(httpRoute.GetNamespace(), canaryService.Name, int64(canaryWeight))
+		if err != nil {
+			return err
+		}
+		backendRefs = append(backendRefs, canaryBackendRef)
+	}
+
+	return unstructured.SetNestedSlice(httpRoute.Object, []interface{}{
+		map[string]interface{}{
+			"backendRefs": backendRefs,
+		},
+	}, "spec", "rules")
+}
+
+// Sets the rules of an http route so that matching requests go to canary and the rest to primary
+func (r *GatewayAPIRouter) setHTTPRouteMatchDestinations(httpRoute *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef,
+	rules []kharonv1alpha1.MatchRule) error {
+	primaryBackendRef, err := r.newHTTPRouteBackendRef(httpRoute.GetNamespace(), primaryService.Name, 100)
+	if err != nil {
+		return err
+	}
+	canaryBackendRef, err := r.newHTTPRouteBackendRef(httpRoute.GetNamespace(), canaryService.Name, 100)
+	if err != nil {
+		return err
+	}
+
+	matches := []interface{}{}
+	for _, rule := range rules {
+		headers := []interface{}{}
+		for _, header := range rule.Headers {
+			matchType := "Exact"
+			if header.Regex {
+				matchType = "RegularExpression"
+			}
+			headers = append(headers, map[string]interface{}{
+				"type":  matchType,
+				"name":  header.Name,
+				"value": header.Value,
+			})
+		}
+		for _, cookie := range rule.Cookies {
+			headers = append(headers, map[string]interface{}{
+				"type":  "RegularExpression",
+				"name":  "Cookie",
+				"value": getCookieRegex(cookie),
+			})
+		}
+		matches = append(matches, map[string]interface{}{
+			"headers": headers,
+		})
+	}
+
+	return unstructured.SetNestedSlice(httpRoute.Object, []interface{}{
+		map[string]interface{}{
+			"matches":     matches,
+			"backendRefs": []interface{}{canaryBackendRef},
+		},
+		map[string]interface{}{
+			"backendRefs": []interface{}{primaryBackendRef},
+		},
+	}, "spec", "rules")
+}
+
+// Sets the rules of an http route so that primary gets all the traffic and it's mirrored to canary
+func (r *GatewayAPIRouter) setHTTPRouteMirrorDestinations(httpRoute *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	primaryBackendRef, err := r.newHTTPRouteBackendRef(httpRoute.GetNamespace(), primaryService.Name, 100)
+	if err != nil {
+		return err
+	}
+	mirrorBackendRef, err := r.newHTTPRouteBackendRef(httpRoute.GetNamespace(), canaryService.Name, 0)
+	if err != nil {
+		return err
+	}
+	// Mirror backendRefs take no weight
+	delete(mirrorBackendRef, "weight")
+
+	return unstructured.SetNestedSlice(httpRoute.Object, []interface{}{
+		map[string]interface{}{
+			"filters": []interface{}{
+				map[string]interface{}{
+					"type": "RequestMirror",
+					"requestMirror": map[string]interface{}{
+						"backendRef": mirrorBackendRef,
+					},
+				},
+			},
+			"backendRefs": []interface{}{primaryBackendRef},
+		},
+	}, "spec", "rules")
+}
+
+// Creates a weighted backendRef pointing to the first port of a Service
+func (r *GatewayAPIRouter) newHTTPRouteBackendRef(namespace string, serviceName string, weight int64) (map[string]interface{}, error) {
+	port, err := getServicePort(r.client, namespace, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"kind":   "Service",
+		"name":   serviceName,
+		"port":   int64(port),
+		"weight": weight,
+	}, nil
+}
+
+// Creates an HTTPRoute with no rules given a TargetHTTPRouteDef
+func newHTTPRouteFromTargetHTTPRouteDef(targetHTTPRouteDef *TargetHTTPRouteDef) *unstructured.Unstructured {
+	httpRoute := &unstructured.Unstructured{}
+	httpRoute.SetGroupVersionKind(httpRouteGVK)
+	httpRoute.SetName(targetHTTPRouteDef.httpRouteName)
+	httpRoute.SetNamespace(targetHTTPRouteDef.namespace)
+	httpRoute.SetLabels(targetHTTPRouteDef.selector)
+	httpRoute.SetAnnotations(map[string]string{
+		"openshift.io/generated-by": operatorName,
+	})
+
+	parentRefs := []interface{}{}
+	for _, parentRef := range targetHTTPRouteDef.parentRefs {
+		ref := map[string]interface{}{
+			"name": parentRef.Name,
+		}
+		if len(parentRef.Namespace) > 0 {
+			ref["namespace"] = parentRef.Namespace
+		}
+		if len(parentRef.SectionName) > 0 {
+			ref["sectionName"] = parentRef.SectionName
+		}
+		parentRefs = append(parentRefs, ref)
+	}
+	spec := map[string]interface{}{
+		"parentRefs": parentRefs,
+	}
+	if len(targetHTTPRouteDef.hostnames) > 0 {
+		spec["hostnames"] = toInterfaceSlice(targetHTTPRouteDef.hostnames)
+	}
+	httpRoute.Object["spec"] = spec
+
+	return httpRoute
+}
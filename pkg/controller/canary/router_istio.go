@@ -0,0 +1,401 @@
+package canary
+
+import (
+	"context"
+	"strings"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+)
+
+const (
+	errorVirtualServiceNotFound = "VirtualService object was deleted or cannot be found"
+)
+
+// Istio objects are handled as unstructured so that we don't depend on the Istio API
+var (
+	virtualServiceGVK = schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "VirtualService",
+	}
+	destinationRuleGVK = schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "DestinationRule",
+	}
+)
+
+// TargetVirtualServiceDef collects data to create a VirtualService
+type TargetVirtualServiceDef struct {
+	virtualServiceName string
+	namespace          string
+	selector           map[string]string
+	hosts              []string
+	gateways           []string
+	primaryService     *DestinationServiceDef
+	canaryService      *DestinationServiceDef
+}
+
+// blank assignment to verify that IstioRouter implements Router, MatchRouter and MirrorRouter
+var _ Router = &IstioRouter{}
+var _ MatchRouter = &IstioRouter{}
+var _ MirrorRouter = &IstioRouter{}
+
+// IstioRouter routes traffic using an Istio VirtualService with a DestinationRule per release
+type IstioRouter struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// CreateDestinations creates a VirtualService for the canary or updates it if it already exists
+func (r *IstioRouter) CreateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	_, err := r.CreateVirtualServiceForCanary(instance, primaryService, canaryService)
+	return err
+}
+
+// UpdateDestinations fetches the VirtualService of the canary and updates its destinations
+func (r *IstioRouter) UpdateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	_, err := r.UpdateVirtualServiceForCanary(instance, primaryService, canaryService)
+	return err
+}
+
+// UpdateMatchDestinations fetches the VirtualService of the canary and routes the requests matching the rules to the canary
+func (r *IstioRouter) UpdateMatchDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef,
+	rules []kharonv1alpha1.MatchRule) error {
+	// Fetch virtual service
+	virtualService, err := r.FetchVirtualService(instance)
+	if err != nil {
+		log.Error(err, errorVirtualServiceNotFound)
+		return err
+	}
+
+	// Destinations may have changed so let's make sure there are DestinationRules for them
+	if err := r.CreateDestinationRulesForCanary(instance, primaryService, canaryService); err != nil {
+		return err
+	}
+
+	// Let's update the virtual service
+	if err := updateVirtualServiceMatchDestinations(virtualService, primaryService, canaryService, rules); err != nil {
+		return err
+	}
+
+	return r.client.Update(context.TODO(), virtualService)
+}
+
+// UpdateMirrorDestinations fetches the VirtualService of the canary and mirrors the traffic sent to primary to the canary
+func (r *IstioRouter) UpdateMirrorDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// Fetch virtual service
+	virtualService, err := r.FetchVirtualService(instance)
+	if err != nil {
+		log.Error(err, errorVirtualServiceNotFound)
+		return err
+	}
+
+	// Destinations may have changed so let's make sure there are DestinationRules for them
+	if err := r.CreateDestinationRulesForCanary(instance, primaryService, canaryService); err != nil {
+		return err
+	}
+
+	// Let's update the virtual service
+	if err := updateVirtualServiceMirrorDestinations(virtualService, primaryService, canaryService); err != nil {
+		return err
+	}
+
+	return r.client.Update(context.TODO(), virtualService)
+}
+
+// FetchVirtualService get the virtual service related to the canary object
+func (r *IstioRouter) FetchVirtualService(instance *kharonv1alpha1.Canary) (*unstructured.Unstructured, error) {
+	virtualService := &unstructured.Unstructured{}
+	virtualService.SetGroupVersionKind(virtualServiceGVK)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, virtualService)
+	if err != nil {
+		return nil, err
+	}
+
+	return virtualService, nil
+}
+
+// CreateVirtualServiceForCanary creates a VirtualService for Target
+func (r *IstioRouter) CreateVirtualServiceForCanary(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	// Every destination needs a DestinationRule defining its subset
+	if err := r.CreateDestinationRulesForCanary(instance, primaryService, canaryService); err != nil {
+		return nil, err
+	}
+
+	// We have to check if there is a VirtualService called canary.Spec.ServiceName, otherwise create it
+	virtualService, err := r.FetchVirtualService(instance)
+	if err != nil && errors.IsNotFound(err) {
+		targetVirtualServiceDef := &TargetVirtualServiceDef{
+			virtualServiceName: instance.Spec.ServiceName,
+			namespace:          instance.Namespace,
+			selector:           instance.Spec.TargetRefSelector,
+			hosts:              instance.Spec.Istio.Hosts,
+			gateways:           instance.Spec.Istio.Gateways,
+			primaryService:     primaryService,
+			canaryService:      canaryService,
+		}
+		if len(targetVirtualServiceDef.hosts) <= 0 {
+			targetVirtualServiceDef.hosts = []string{instance.Spec.ServiceName}
+		}
+		virtualService = newVirtualServiceFromTargetVirtualServiceDef(targetVirtualServiceDef)
+		// Set Canary instance as the owner and controller
+		if err := controllerutil.SetControllerReference(instance, virtualService, r.scheme); err != nil {
+			return nil, err
+		}
+		log.Info("Creating the canary virtual service", "VirtualService.Namespace", virtualService.GetNamespace(), "VirtualService.Name", virtualService.GetName())
+		err = r.client.Create(context.TODO(), virtualService)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		// No errors, so return created VirtualService
+		return virtualService, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Let's update the virtual service
+	return r.UpdateVirtualServiceDestinationsForCanary(virtualService, primaryService, canaryService)
+}
+
+// UpdateVirtualServiceForCanary fetches the VirtualService related to the canary object and updates its destinations
+func (r *IstioRouter) UpdateVirtualServiceForCanary(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	// Fetch virtual service
+	virtualService, err := r.FetchVirtualService(instance)
+	if err != nil {
+		log.Error(err, errorVirtualServiceNotFound)
+		return nil, err
+	}
+
+	// Destinations may have changed so let's make sure there are DestinationRules for them
+	if err := r.CreateDestinationRulesForCanary(instance, primaryService, canaryService); err != nil {
+		return nil, err
+	}
+
+	return r.UpdateVirtualServiceDestinationsForCanary(virtualService, primaryService, canaryService)
+}
+
+// UpdateVirtualServiceDestinationsForCanary updates a VirtualService with new destinations
+func (r *IstioRouter) UpdateVirtualServiceDestinationsForCanary(
+	virtualService *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	if virtualService == nil {
+		return nil, _util.NewError("No virtual service to be updated")
+	}
+
+	// Let's update the virtual service
+	if err := updateVirtualServiceDestinations(virtualService, primaryService, canaryService); err != nil {
+		return nil, err
+	}
+	if err := r.client.Update(context.TODO(), virtualService); err != nil {
+		return nil, err
+	}
+
+	return virtualService, nil
+}
+
+// CreateDestinationRulesForCanary creates the DestinationRules for primary and canary services if they don't exist
+func (r *IstioRouter) CreateDestinationRulesForCanary(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	for _, destination := range []*DestinationServiceDef{primaryService, canaryService} {
+		if destination == nil || len(destination.Name) <= 0 {
+			continue
+		}
+		if err := r.CreateDestinationRuleForService(instance, destination.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateDestinationRuleForService creates a DestinationRule with a subset selecting the pods of a Service
+func (r *IstioRouter) CreateDestinationRuleForService(instance *kharonv1alpha1.Canary, serviceName string) error {
+	destinationRule := &unstructured.Unstructured{}
+	destinationRule.SetGroupVersionKind(destinationRuleGVK)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: serviceName, Namespace: instance.Namespace}, destinationRule)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	// The subset selects the same pods the Service does
+	service := &corev1.Service{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: serviceName, Namespace: instance.Namespace}, service); err != nil {
+		return err
+	}
+
+	destinationRule = newDestinationRuleFromService(service)
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, destinationRule, r.scheme); err != nil {
+		return err
+	}
+	log.Info("Creating the canary destination rule", "DestinationRule.Namespace", destinationRule.GetNamespace(), "DestinationRule.Name", destinationRule.GetName())
+	err = r.client.Create(context.TODO(), destinationRule)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Creates a VirtualService given a TargetVirtualServiceDef
+func newVirtualServiceFromTargetVirtualServiceDef(targetVirtualServiceDef *TargetVirtualServiceDef) *unstructured.Unstructured {
+	virtualService := &unstructured.Unstructured{}
+	virtualService.SetGroupVersionKind(virtualServiceGVK)
+	virtualService.SetName(targetVirtualServiceDef.virtualServiceName)
+	virtualService.SetNamespace(targetVirtualServiceDef.namespace)
+	virtualService.SetLabels(targetVirtualServiceDef.selector)
+	virtualService.SetAnnotations(map[string]string{
+		"openshift.io/generated-by": operatorName,
+	})
+
+	spec := map[string]interface{}{
+		"hosts": toInterfaceSlice(targetVirtualServiceDef.hosts),
+	}
+	if len(targetVirtualServiceDef.gateways) > 0 {
+		spec["gateways"] = toInterfaceSlice(targetVirtualServiceDef.gateways)
+	}
+	virtualService.Object["spec"] = spec
+	updateVirtualServiceDestinations(virtualService, targetVirtualServiceDef.primaryService, targetVirtualServiceDef.canaryService)
+
+	return virtualService
+}
+
+// Creates a DestinationRule with one subset named as the Service
+func newDestinationRuleFromService(service *corev1.Service) *unstructured.Unstructured {
+	destinationRule := &unstructured.Unstructured{}
+	destinationRule.SetGroupVersionKind(destinationRuleGVK)
+	destinationRule.SetName(service.Name)
+	destinationRule.SetNamespace(service.Namespace)
+	destinationRule.SetLabels(service.Spec.Selector)
+	destinationRule.SetAnnotations(map[string]string{
+		"openshift.io/generated-by": operatorName,
+	})
+
+	labels := map[string]interface{}{}
+	for key, value := range service.Spec.Selector {
+		labels[key] = value
+	}
+	destinationRule.Object["spec"] = map[string]interface{}{
+		"host": service.Name,
+		"subsets": []interface{}{
+			map[string]interface{}{
+				"name":   service.Name,
+				"labels": labels,
+			},
+		},
+	}
+
+	return destinationRule
+}
+
+// Updates the http route of a virtual service
+func updateVirtualServiceDestinations(virtualService *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	destinations := []interface{}{newVirtualServiceDestination(primaryService.Name, int64(primaryService.Weight))}
+	if canaryService != nil && (DestinationServiceDef{}) != *canaryService {
+		canaryWeight := 100 - primaryService.Weight
+		destinations = append(destinations, newVirtualServiceDestination(canaryService.Name, int64(canaryWeight)))
+	}
+
+	return unstructured.SetNestedSlice(virtualService.Object, []interface{}{
+		map[string]interface{}{
+			"route": destinations,
+		},
+	}, "spec", "http")
+}
+
+// Updates the http routes of a virtual service so that matching requests go to canary and the rest to primary
+func updateVirtualServiceMatchDestinations(virtualService *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef,
+	rules []kharonv1alpha1.MatchRule) error {
+	matches := []interface{}{}
+	for _, rule := range rules {
+		headers := map[string]interface{}{}
+		for _, header := range rule.Headers {
+			matchType := "exact"
+			if header.Regex {
+				matchType = "regex"
+			}
+			headers[strings.ToLower(header.Name)] = map[string]interface{}{
+				matchType: header.Value,
+			}
+		}
+		for _, cookie := range rule.Cookies {
+			headers["cookie"] = map[string]interface{}{
+				"regex": getCookieRegex(cookie),
+			}
+		}
+		matches = append(matches, map[string]interface{}{
+			"headers": headers,
+		})
+	}
+
+	return unstructured.SetNestedSlice(virtualService.Object, []interface{}{
+		map[string]interface{}{
+			"match": matches,
+			"route": []interface{}{newVirtualServiceDestination(canaryService.Name, 100)},
+		},
+		map[string]interface{}{
+			"route": []interface{}{newVirtualServiceDestination(primaryService.Name, 100)},
+		},
+	}, "spec", "http")
+}
+
+// Updates the http route of a virtual service so that primary gets all the traffic and it's mirrored to canary
+func updateVirtualServiceMirrorDestinations(virtualService *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	return unstructured.SetNestedSlice(virtualService.Object, []interface{}{
+		map[string]interface{}{
+			"route": []interface{}{newVirtualServiceDestination(primaryService.Name, 100)},
+			"mirror": map[string]interface{}{
+				"host":   canaryService.Name,
+				"subset": canaryService.Name,
+			},
+			"mirrorPercentage": map[string]interface{}{
+				"value": float64(100),
+			},
+		},
+	}, "spec", "http")
+}
+
+// Creates a weighted destination pointing to the subset of a Service
+func newVirtualServiceDestination(serviceName string, weight int64) map[string]interface{} {
+	return map[string]interface{}{
+		"destination": map[string]interface{}{
+			"host":   serviceName,
+			"subset": serviceName,
+		},
+		"weight": weight,
+	}
+}
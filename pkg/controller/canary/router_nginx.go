@@ -0,0 +1,243 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+)
+
+const (
+	errorIngressNotFound = "Primary Ingress object was deleted or cannot be found"
+)
+
+const (
+	nginxCanaryAnnotation       = "nginx.ingress.kubernetes.io/canary"
+	nginxCanaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+)
+
+// Ingress objects are handled as unstructured so that we don't depend on the (deprecated) vendored extensions API
+var ingressGVK = schema.GroupVersionKind{
+	Group:   "networking.k8s.io",
+	Version: "v1",
+	Kind:    "Ingress",
+}
+
+// blank assignment to verify that NginxIngressRouter implements Router
+var _ Router = &NginxIngressRouter{}
+
+// NginxIngressRouter routes traffic cloning the primary Ingress into a canary Ingress annotated
+// for ingress-nginx with the canary weight
+type NginxIngressRouter struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// CreateDestinations points the primary Ingress to the primary service and creates, updates or deletes
+// the canary Ingress. The primary Ingress is not created by Kharon so it has to exist
+func (r *NginxIngressRouter) CreateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	return r.UpdateDestinations(instance, primaryService, canaryService)
+}
+
+// UpdateDestinations points the primary Ingress to the primary service and creates, updates or deletes
+// the canary Ingress
+func (r *NginxIngressRouter) UpdateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// Fetch primary ingress
+	primaryIngress, err := r.FetchIngress(instance, getPrimaryIngressName(instance))
+	if err != nil {
+		log.Error(err, errorIngressNotFound)
+		return err
+	}
+
+	// Primary ingress should point to the primary service
+	if _, err := r.UpdateIngressBackendForCanary(primaryIngress, primaryService); err != nil {
+		return err
+	}
+
+	// No canary, so no canary ingress
+	if canaryService == nil || (DestinationServiceDef{}) == *canaryService {
+		return r.DeleteCanaryIngress(instance)
+	}
+
+	canaryIngress, err := r.FetchIngress(instance, getCanaryIngressName(instance))
+	if err != nil && errors.IsNotFound(err) {
+		_, err = r.CreateCanaryIngressForCanary(instance, primaryIngress, primaryService, canaryService)
+		return err
+	} else if err != nil {
+		return err
+	}
+	canaryIngress.SetAnnotations(newCanaryIngressAnnotations(canaryIngress.GetAnnotations(), 100-primaryService.Weight))
+	_, err = r.UpdateIngressBackendForCanary(canaryIngress, canaryService)
+	return err
+}
+
+// FetchIngress get an ingress by name in the namespace of the canary object
+func (r *NginxIngressRouter) FetchIngress(instance *kharonv1alpha1.Canary, name string) (*unstructured.Unstructured, error) {
+	ingress := &unstructured.Unstructured{}
+	ingress.SetGroupVersionKind(ingressGVK)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, ingress)
+	if err != nil {
+		return nil, err
+	}
+
+	return ingress, nil
+}
+
+// CreateCanaryIngressForCanary creates the canary Ingress cloning the primary one
+func (r *NginxIngressRouter) CreateCanaryIngressForCanary(instance *kharonv1alpha1.Canary,
+	primaryIngress *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	canaryIngress := newCanaryIngressFromPrimaryIngress(primaryIngress, getCanaryIngressName(instance), 100-primaryService.Weight)
+	if err := r.setIngressBackends(canaryIngress, canaryService.Name); err != nil {
+		return nil, err
+	}
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, canaryIngress, r.scheme); err != nil {
+		return nil, err
+	}
+	log.Info("Creating the canary ingress", "Ingress.Namespace", canaryIngress.GetNamespace(), "Ingress.Name", canaryIngress.GetName())
+	err := r.client.Create(context.TODO(), canaryIngress)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	return canaryIngress, nil
+}
+
+// UpdateIngressBackendForCanary points every backend of an Ingress to a service
+func (r *NginxIngressRouter) UpdateIngressBackendForCanary(
+	ingress *unstructured.Unstructured,
+	service *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	if ingress == nil {
+		return nil, _util.NewError("No ingress to be updated")
+	}
+
+	// Let's update the ingress
+	if err := r.setIngressBackends(ingress, service.Name); err != nil {
+		return nil, err
+	}
+	if err := r.client.Update(context.TODO(), ingress); err != nil {
+		return nil, err
+	}
+
+	return ingress, nil
+}
+
+// DeleteCanaryIngress deletes the canary Ingress if it exists
+func (r *NginxIngressRouter) DeleteCanaryIngress(instance *kharonv1alpha1.Canary) error {
+	canaryIngress, err := r.FetchIngress(instance, getCanaryIngressName(instance))
+	if err != nil && errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	log.Info("Deleting the canary ingress", "Ingress.Namespace", canaryIngress.GetNamespace(), "Ingress.Name", canaryIngress.GetName())
+	if err := r.client.Delete(context.TODO(), canaryIngress); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Points the default backend and the backends of every path of an ingress to a service
+func (r *NginxIngressRouter) setIngressBackends(ingress *unstructured.Unstructured, serviceName string) error {
+	port, err := getServicePort(r.client, ingress.GetNamespace(), serviceName)
+	if err != nil {
+		return err
+	}
+	backend := map[string]interface{}{
+		"service": map[string]interface{}{
+			"name": serviceName,
+			"port": map[string]interface{}{
+				"number": int64(port),
+			},
+		},
+	}
+
+	if _, found, _ := unstructured.NestedMap(ingress.Object, "spec", "defaultBackend"); found {
+		if err := unstructured.SetNestedMap(ingress.Object, backend, "spec", "defaultBackend"); err != nil {
+			return err
+		}
+	}
+
+	rules, _, err := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, err := unstructured.NestedSlice(rule, "http", "paths")
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if path, ok := path.(map[string]interface{}); ok {
+				path["backend"] = runtime.DeepCopyJSONValue(backend)
+			}
+		}
+		if err := unstructured.SetNestedSlice(rule, paths, "http", "paths"); err != nil {
+			return err
+		}
+	}
+
+	return unstructured.SetNestedSlice(ingress.Object, rules, "spec", "rules")
+}
+
+// Clones the primary ingress into a canary ingress with the canary annotations
+func newCanaryIngressFromPrimaryIngress(primaryIngress *unstructured.Unstructured, name string, canaryWeight int32) *unstructured.Unstructured {
+	canaryIngress := &unstructured.Unstructured{}
+	canaryIngress.SetGroupVersionKind(ingressGVK)
+	canaryIngress.SetName(name)
+	canaryIngress.SetNamespace(primaryIngress.GetNamespace())
+	canaryIngress.SetLabels(primaryIngress.GetLabels())
+
+	annotations := newCanaryIngressAnnotations(primaryIngress.GetAnnotations(), canaryWeight)
+	annotations["openshift.io/generated-by"] = operatorName
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	canaryIngress.SetAnnotations(annotations)
+
+	if spec, found, _ := unstructured.NestedMap(primaryIngress.Object, "spec"); found {
+		canaryIngress.Object["spec"] = spec
+	}
+
+	return canaryIngress
+}
+
+// Copies annotations adding the ones ingress-nginx needs to treat an ingress as a canary
+func newCanaryIngressAnnotations(annotations map[string]string, canaryWeight int32) map[string]string {
+	result := map[string]string{}
+	for key, value := range annotations {
+		result[key] = value
+	}
+	result[nginxCanaryAnnotation] = "true"
+	result[nginxCanaryWeightAnnotation] = fmt.Sprintf("%d", canaryWeight)
+
+	return result
+}
+
+func getPrimaryIngressName(instance *kharonv1alpha1.Canary) string {
+	return _util.NVL(instance.Spec.NginxIngress.IngressName, instance.Spec.ServiceName)
+}
+
+func getCanaryIngressName(instance *kharonv1alpha1.Canary) string {
+	return getPrimaryIngressName(instance) + "-canary"
+}
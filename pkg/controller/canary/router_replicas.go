@@ -0,0 +1,175 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	oappsv1 "github.com/openshift/api/apps/v1"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+)
+
+const (
+	errorReleaseNotFound = "Release cannot be found in TargetRef or ReleaseHistory"
+)
+
+// Replicas shared by primary and canary, at least one each until the canary is promoted
+const minReplicaRatioReplicas = 2
+
+// blank assignment to verify that ReplicaRatioRouter implements Router
+var _ Router = &ReplicaRatioRouter{}
+
+// ReplicaRatioRouter needs no L7 router, one Service named ServiceName selects the pods of every release
+// and traffic is split scaling primary and canary so that their replicas match their weights
+type ReplicaRatioRouter struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// CreateDestinations creates the Service shared by primary and canary if it doesn't exist and scales them
+func (r *ReplicaRatioRouter) CreateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	if _, err := r.CreateSharedServiceForCanary(instance, primaryService); err != nil {
+		return err
+	}
+
+	return r.UpdateDestinations(instance, primaryService, canaryService)
+}
+
+// UpdateDestinations scales primary and canary according to their weights, every other release is scaled to zero.
+// Releases scaled to zero may have been deleted already, those are skipped
+func (r *ReplicaRatioRouter) UpdateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	replicas := map[string]int32{}
+	// Releases not receiving traffic are scaled down
+	for _, release := range instance.Status.ReleaseHistory {
+		replicas[release.Name] = 0
+	}
+	replicas[instance.Spec.TargetRef.Name] = 0
+
+	canaryReplicas := int32(0)
+	if canaryService != nil && (DestinationServiceDef{}) != *canaryService {
+		canaryReplicas = getReplicasForWeight(instance.Spec.ReplicaRatio.Replicas, 100-primaryService.Weight)
+		replicas[canaryService.Name] = canaryReplicas
+	}
+	replicas[primaryService.Name] = instance.Spec.ReplicaRatio.Replicas - canaryReplicas
+
+	for name, count := range replicas {
+		ref, ok := findReleaseRefByName(instance, name)
+		if !ok {
+			err := errors.NewBadRequest(fmt.Sprintf("%s: %s", errorReleaseNotFound, name))
+			log.Error(err, errorReleaseNotFound)
+			return err
+		}
+		if err := r.ScaleRelease(instance.Namespace, ref, count); err != nil {
+			if count <= 0 && errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateSharedServiceForCanary creates the Service named ServiceName if it doesn't exist, it copies the ports
+// from the primary service and selects the pods using ReplicaRatio.Selector
+func (r *ReplicaRatioRouter) CreateSharedServiceForCanary(instance *kharonv1alpha1.Canary, primaryService *DestinationServiceDef) (*corev1.Service, error) {
+	sharedService := &corev1.Service{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, sharedService)
+	if err == nil {
+		return sharedService, nil
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	service := &corev1.Service{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: primaryService.Name, Namespace: instance.Namespace}, service); err != nil {
+		return nil, err
+	}
+	sharedService = newRootServiceFromService(instance.Spec.ServiceName, service)
+	sharedService.Labels = instance.Spec.ReplicaRatio.Selector
+	sharedService.Spec.Selector = instance.Spec.ReplicaRatio.Selector
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, sharedService, r.scheme); err != nil {
+		return nil, err
+	}
+	log.Info("Creating the canary shared service", "SharedService.Namespace", sharedService.Namespace, "SharedService.Name", sharedService.Name)
+	err = r.client.Create(context.TODO(), sharedService)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	return sharedService, nil
+}
+
+// ScaleRelease sets the replicas of the Deployment or DeploymentConfig of a release, it's left alone if it already has them
+func (r *ReplicaRatioRouter) ScaleRelease(namespace string, ref kharonv1alpha1.Ref, replicas int32) error {
+	switch ref.Kind {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: namespace}, deployment); err != nil {
+			return err
+		}
+		if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == replicas {
+			return nil
+		}
+		log.Info("Scaling release", "Deployment.Namespace", namespace, "Deployment.Name", ref.Name, "Replicas", replicas)
+		deployment.Spec.Replicas = &replicas
+		return r.client.Update(context.TODO(), deployment)
+	case "DeploymentConfig":
+		deploymentConfig := &oappsv1.DeploymentConfig{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: namespace}, deploymentConfig); err != nil {
+			return err
+		}
+		if deploymentConfig.Spec.Replicas == replicas {
+			return nil
+		}
+		log.Info("Scaling release", "DeploymentConfig.Namespace", namespace, "DeploymentConfig.Name", ref.Name, "Replicas", replicas)
+		deploymentConfig.Spec.Replicas = replicas
+		return r.client.Update(context.TODO(), deploymentConfig)
+	default:
+		return _util.NewError(errorTargetRefKind)
+	}
+}
+
+// Returns the replicas out of total, at least 2, matching a weight. A release with some weight gets at least one
+// replica and a release with less than 100% leaves one for the other, so the primary serves until promotion
+func getReplicasForWeight(total int32, weight int32) int32 {
+	replicas := int32(math.Round(float64(total) * float64(weight) / 100.0))
+	if weight > 0 && replicas <= 0 {
+		replicas = 1
+	}
+	if weight < 100 && replicas >= total {
+		replicas = total - 1
+	}
+
+	return replicas
+}
+
+// Looks for the Ref of a release by name in TargetRef and ReleaseHistory
+func findReleaseRefByName(instance *kharonv1alpha1.Canary, name string) (kharonv1alpha1.Ref, bool) {
+	if instance.Spec.TargetRef.Name == name {
+		return instance.Spec.TargetRef, true
+	}
+	for i := len(instance.Status.ReleaseHistory) - 1; i >= 0; i-- {
+		if instance.Status.ReleaseHistory[i].Name == name {
+			return instance.Status.ReleaseHistory[i].Ref, true
+		}
+	}
+
+	return kharonv1alpha1.Ref{}, false
+}
@@ -0,0 +1,29 @@
+package canary
+
+import (
+	"testing"
+)
+
+func TestGetReplicasForWeight(t *testing.T) {
+	tests := []struct {
+		total    int32
+		weight   int32
+		replicas int32
+	}{
+		{2, 10, 1},
+		{2, 90, 1},
+		{2, 100, 2},
+		{2, 0, 0},
+		{10, 10, 1},
+		{10, 1, 1},
+		{10, 50, 5},
+		{10, 99, 9},
+		{10, 100, 10},
+		{4, 30, 1},
+	}
+	for _, test := range tests {
+		if replicas := getReplicasForWeight(test.total, test.weight); replicas != test.replicas {
+			t.Errorf("getReplicasForWeight(%d, %d) = %d, want %d", test.total, test.weight, replicas, test.replicas)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package canary
+
+import (
+	"context"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+)
+
+// TargetRouteDef collects data to create a Route
+type TargetRouteDef struct {
+	routeName      string
+	namespace      string
+	selector       map[string]string
+	targetPort     intstr.IntOrString
+	primaryService *DestinationServiceDef
+	canaryService  *DestinationServiceDef
+}
+
+// blank assignment to verify that RouteRouter implements Router and PreviewRouter
+var _ Router = &RouteRouter{}
+var _ PreviewRouter = &RouteRouter{}
+
+// RouteRouter routes traffic using an OpenShift Route with alternate backends
+type RouteRouter struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// CreateDestinations creates a Route for the canary or updates it if it already exists
+func (r *RouteRouter) CreateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// We have to check if there is a Route called canary.Spec.ServiceName, otherwise create it
+	route, err := r.FetchRoute(instance)
+	if err != nil && errors.IsNotFound(err) {
+		_, err = r.CreateRouteForCanary(instance, primaryService, canaryService)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	_, err = r.UpdateRouteDestinationsForCanary(route, primaryService, canaryService)
+	return err
+}
+
+// UpdateDestinations fetches the Route of the canary and updates its destinations
+func (r *RouteRouter) UpdateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// Fetch route
+	route, err := r.FetchRoute(instance)
+	if err != nil {
+		log.Error(err, errorRouteNotFound)
+		return err
+	}
+
+	_, err = r.UpdateRouteDestinationsForCanary(route, primaryService, canaryService)
+	return err
+}
+
+// CreatePreview creates a preview Route pointing only to previewService or updates it if it already exists
+func (r *RouteRouter) CreatePreview(instance *kharonv1alpha1.Canary, previewService *DestinationServiceDef) error {
+	canaryService := &DestinationServiceDef{}
+	previewRoute := &routev1.Route{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: getPreviewRouteName(instance), Namespace: instance.Namespace}, previewRoute)
+	if err != nil && errors.IsNotFound(err) {
+		targetRouteDef := &TargetRouteDef{
+			routeName:      getPreviewRouteName(instance),
+			namespace:      instance.Namespace,
+			selector:       instance.Spec.TargetRefSelector,
+			targetPort:     instance.Spec.TargetRefContainerPort,
+			primaryService: previewService,
+			canaryService:  canaryService,
+		}
+		previewRoute = newRouteFromTargetRouteDef(targetRouteDef)
+		// Set Canary instance as the owner and controller
+		if err := controllerutil.SetControllerReference(instance, previewRoute, r.scheme); err != nil {
+			return err
+		}
+		log.Info("Creating the preview route", "PreviewRoute.Namespace", previewRoute.Namespace, "PreviewRoute.Name", previewRoute.Name)
+		err = r.client.Create(context.TODO(), previewRoute)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = r.UpdateRouteDestinationsForCanary(previewRoute, previewService, canaryService)
+	return err
+}
+
+// DeletePreview deletes the preview Route if it exists
+func (r *RouteRouter) DeletePreview(instance *kharonv1alpha1.Canary) error {
+	previewRoute := &routev1.Route{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: getPreviewRouteName(instance), Namespace: instance.Namespace}, previewRoute)
+	if err != nil && errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	log.Info("Deleting the preview route", "PreviewRoute.Namespace", previewRoute.Namespace, "PreviewRoute.Name", previewRoute.Name)
+	if err := r.client.Delete(context.TODO(), previewRoute); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// FetchRoute get the route related to the canary object
+func (r *RouteRouter) FetchRoute(instance *kharonv1alpha1.Canary) (*routev1.Route, error) {
+	route := &routev1.Route{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, route)
+	if err != nil {
+		return nil, err
+	}
+
+	return route, nil
+}
+
+// CreateRouteForCanary creates a Route for Target
+func (r *RouteRouter) CreateRouteForCanary(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*routev1.Route, error) {
+	// There's no route, so we have to create it from a route definition object (TargetRouteDef)
+	// TargetRouteDef defines primary and canary services to route traffic to
+
+	// The Route we need should be named as the Deployment because exposes the Deployment logic (as a canary)
+	targetRouteDef := &TargetRouteDef{
+		routeName:      instance.Spec.ServiceName,
+		namespace:      instance.Namespace,
+		selector:       instance.Spec.TargetRefSelector,
+		targetPort:     instance.Spec.TargetRefContainerPort,
+		primaryService: primaryService,
+		canaryService:  canaryService,
+	}
+	targetRoute := newRouteFromTargetRouteDef(targetRouteDef)
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, targetRoute, r.scheme); err != nil {
+		return nil, err
+	}
+	log.Info("Creating the canary route", "CanaryService.Namespace", targetRoute.Namespace, "CanaryService.Name", targetRoute.Name)
+	err := r.client.Create(context.TODO(), targetRoute)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	return targetRoute, nil
+}
+
+// UpdateRouteDestinationsForCanary updates a Route with new destinations
+func (r *RouteRouter) UpdateRouteDestinationsForCanary(
+	route *routev1.Route,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*routev1.Route, error) {
+	if route == nil {
+		return nil, _util.NewError("No route to be updated")
+	}
+
+	// Let's update the route
+	updateRouteDestinations(route, primaryService, canaryService)
+	if err := r.client.Update(context.TODO(), route); err != nil {
+		return nil, err
+	}
+
+	return route, nil
+}
+
+// Creates a Route given a ...
+func newRouteFromTargetRouteDef(targetRouteDef *TargetRouteDef) *routev1.Route {
+	annotations := map[string]string{
+		"openshift.io/generated-by": operatorName,
+	}
+	alternateBackends := []routev1.RouteTargetReference{}
+	if len(targetRouteDef.canaryService.Name) > 0 {
+		canaryWeight := 100 - targetRouteDef.primaryService.Weight
+		alternateBackends = []routev1.RouteTargetReference{routev1.RouteTargetReference{
+			Kind:   "Service",
+			Name:   targetRouteDef.canaryService.Name,
+			Weight: &canaryWeight,
+		}}
+	}
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        targetRouteDef.routeName,
+			Namespace:   targetRouteDef.namespace,
+			Labels:      targetRouteDef.selector,
+			Annotations: annotations,
+		},
+		Spec: routev1.RouteSpec{
+			Port: &routev1.RoutePort{
+				TargetPort: targetRouteDef.targetPort,
+			},
+			To: routev1.RouteTargetReference{
+				Kind:   "Service",
+				Name:   targetRouteDef.primaryService.Name,
+				Weight: &targetRouteDef.primaryService.Weight,
+			},
+			AlternateBackends: alternateBackends,
+		},
+	}
+}
+
+// Updates destinations of route
+func updateRouteDestinations(route *routev1.Route,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) {
+	route.Spec.To = routev1.RouteTargetReference{
+		Kind:   "Service",
+		Name:   primaryService.Name,
+		Weight: &primaryService.Weight,
+	}
+	alternateBackends := []routev1.RouteTargetReference{}
+	if canaryService != nil && (DestinationServiceDef{}) != *canaryService {
+		canaryWeight := 100 - primaryService.Weight
+		alternateBackends = []routev1.RouteTargetReference{routev1.RouteTargetReference{
+			Kind:   "Service",
+			Name:   canaryService.Name,
+			Weight: &canaryWeight,
+		}}
+	}
+	route.Spec.AlternateBackends = alternateBackends
+}
+
+func getPreviewRouteName(instance *kharonv1alpha1.Canary) string {
+	return instance.Spec.ServiceName + "-preview"
+}
@@ -0,0 +1,219 @@
+package canary
+
+import (
+	"context"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	// Util
+	_util "github.com/redhat/kharon-operator/pkg/util"
+)
+
+const (
+	errorTrafficSplitNotFound = "TrafficSplit object was deleted or cannot be found"
+)
+
+// SMI objects are handled as unstructured so that we don't depend on the SMI API
+var trafficSplitGVK = schema.GroupVersionKind{
+	Group:   "split.smi-spec.io",
+	Version: "v1alpha2",
+	Kind:    "TrafficSplit",
+}
+
+// blank assignment to verify that SMIRouter implements Router
+var _ Router = &SMIRouter{}
+
+// SMIRouter routes traffic using an SMI TrafficSplit whose root service is ServiceName
+type SMIRouter struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// CreateDestinations creates the root Service and a TrafficSplit for the canary or updates it if it already exists
+func (r *SMIRouter) CreateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// The mesh splits traffic sent to the root service, so it has to exist
+	if _, err := r.CreateRootServiceForCanary(instance, primaryService); err != nil {
+		return err
+	}
+
+	// We have to check if there is a TrafficSplit called canary.Spec.ServiceName, otherwise create it
+	trafficSplit, err := r.FetchTrafficSplit(instance)
+	if err != nil && errors.IsNotFound(err) {
+		_, err = r.CreateTrafficSplitForCanary(instance, primaryService, canaryService)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	_, err = r.UpdateTrafficSplitBackendsForCanary(trafficSplit, primaryService, canaryService)
+	return err
+}
+
+// UpdateDestinations fetches the TrafficSplit of the canary and updates its backends
+func (r *SMIRouter) UpdateDestinations(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	// Fetch traffic split
+	trafficSplit, err := r.FetchTrafficSplit(instance)
+	if err != nil {
+		log.Error(err, errorTrafficSplitNotFound)
+		return err
+	}
+
+	_, err = r.UpdateTrafficSplitBackendsForCanary(trafficSplit, primaryService, canaryService)
+	return err
+}
+
+// FetchTrafficSplit get the traffic split related to the canary object
+func (r *SMIRouter) FetchTrafficSplit(instance *kharonv1alpha1.Canary) (*unstructured.Unstructured, error) {
+	trafficSplit := &unstructured.Unstructured{}
+	trafficSplit.SetGroupVersionKind(trafficSplitGVK)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, trafficSplit)
+	if err != nil {
+		return nil, err
+	}
+
+	return trafficSplit, nil
+}
+
+// CreateRootServiceForCanary creates the root Service named ServiceName if it doesn't exist, it copies
+// selector and ports from the primary service
+func (r *SMIRouter) CreateRootServiceForCanary(instance *kharonv1alpha1.Canary, primaryService *DestinationServiceDef) (*corev1.Service, error) {
+	rootService := &corev1.Service{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceName, Namespace: instance.Namespace}, rootService)
+	if err == nil {
+		return rootService, nil
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	service := &corev1.Service{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: primaryService.Name, Namespace: instance.Namespace}, service); err != nil {
+		return nil, err
+	}
+	rootService = newRootServiceFromService(instance.Spec.ServiceName, service)
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, rootService, r.scheme); err != nil {
+		return nil, err
+	}
+	log.Info("Creating the canary root service", "RootService.Namespace", rootService.Namespace, "RootService.Name", rootService.Name)
+	err = r.client.Create(context.TODO(), rootService)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	return rootService, nil
+}
+
+// CreateTrafficSplitForCanary creates a TrafficSplit for Target
+func (r *SMIRouter) CreateTrafficSplitForCanary(instance *kharonv1alpha1.Canary,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	trafficSplit := &unstructured.Unstructured{}
+	trafficSplit.SetGroupVersionKind(trafficSplitGVK)
+	trafficSplit.SetName(instance.Spec.ServiceName)
+	trafficSplit.SetNamespace(instance.Namespace)
+	trafficSplit.SetLabels(instance.Spec.TargetRefSelector)
+	trafficSplit.SetAnnotations(map[string]string{
+		"openshift.io/generated-by": operatorName,
+	})
+	trafficSplit.Object["spec"] = map[string]interface{}{
+		"service": instance.Spec.ServiceName,
+	}
+	if err := updateTrafficSplitBackends(trafficSplit, primaryService, canaryService); err != nil {
+		return nil, err
+	}
+	// Set Canary instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, trafficSplit, r.scheme); err != nil {
+		return nil, err
+	}
+	log.Info("Creating the canary traffic split", "TrafficSplit.Namespace", trafficSplit.GetNamespace(), "TrafficSplit.Name", trafficSplit.GetName())
+	err := r.client.Create(context.TODO(), trafficSplit)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	return trafficSplit, nil
+}
+
+// UpdateTrafficSplitBackendsForCanary updates a TrafficSplit with new backends
+func (r *SMIRouter) UpdateTrafficSplitBackendsForCanary(
+	trafficSplit *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) (*unstructured.Unstructured, error) {
+	if trafficSplit == nil {
+		return nil, _util.NewError("No traffic split to be updated")
+	}
+
+	// Let's update the traffic split
+	if err := updateTrafficSplitBackends(trafficSplit, primaryService, canaryService); err != nil {
+		return nil, err
+	}
+	if err := r.client.Update(context.TODO(), trafficSplit); err != nil {
+		return nil, err
+	}
+
+	return trafficSplit, nil
+}
+
+// Updates the weighted backends of a traffic split
+func updateTrafficSplitBackends(trafficSplit *unstructured.Unstructured,
+	primaryService *DestinationServiceDef,
+	canaryService *DestinationServiceDef) error {
+	backends := []interface{}{
+		map[string]interface{}{
+			"service": primaryService.Name,
+			"weight":  int64(primaryService.Weight),
+		},
+	}
+	if canaryService != nil && (DestinationServiceDef{}) != *canaryService {
+		canaryWeight := 100 - primaryService.Weight
+		backends = append(backends, map[string]interface{}{
+			"service": canaryService.Name,
+			"weight":  int64(canaryWeight),
+		})
+	}
+
+	return unstructured.SetNestedSlice(trafficSplit.Object, backends, "spec", "backends")
+}
+
+// Creates the root service of a traffic split with the selector and ports of another service
+func newRootServiceFromService(name string, service *corev1.Service) *corev1.Service {
+	annotations := map[string]string{
+		"openshift.io/generated-by": operatorName,
+	}
+	ports := []corev1.ServicePort{}
+	for _, port := range service.Spec.Ports {
+		ports = append(ports, corev1.ServicePort{
+			Name:       port.Name,
+			Protocol:   port.Protocol,
+			Port:       port.Port,
+			TargetPort: port.TargetPort,
+		})
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   service.Namespace,
+			Labels:      service.Spec.Selector,
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:            corev1.ServiceTypeClusterIP,
+			SessionAffinity: corev1.ServiceAffinityNone,
+			Selector:        service.Spec.Selector,
+			Ports:           ports,
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package loadtest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Seconds before a request is cancelled
+const requestTimeout = 10 * time.Second
+
+// Run sends requests to url at a rate of requestsPerSecond until ctx is done or duration has passed, responses
+// and errors are discarded as the point is the samples they leave in the metrics of the target
+func Run(ctx context.Context, method string, url string, requestsPerSecond int32, duration time.Duration) {
+	if requestsPerSecond <= 0 || duration <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	client := &http.Client{Timeout: requestTimeout}
+	ticker := time.NewTicker(time.Second / time.Duration(requestsPerSecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			go sendRequest(ctx, client, method, url)
+		}
+	}
+}
+
+// Sends a request and drains the response so that the connection is reused
+func sendRequest(ctx context.Context, client *http.Client, method string, url string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	_errors "errors"
+)
+
+const (
+	errorInvalidCABundle        = "CA bundle of the metrics server has no valid certificates"
+	errorMetricsServerBadStatus = "Metrics server answered with an unexpected status"
+)
+
+// Timeout of a query if none is set
+const defaultQueryTimeout = 10 * time.Second
+
+// MetricsServerAuth holds the credentials to access a metrics server, every field is optional
+type MetricsServerAuth struct {
+	BearerToken string
+	Username    string
+	Password    string
+	// Datadog API and application keys
+	APIKey         string
+	ApplicationKey string
+	// PEM encoded client certificate and key
+	CertPEM []byte
+	KeyPEM  []byte
+	// PEM encoded CA bundle to verify the metrics server
+	CAPEM []byte
+}
+
+// MetricsClient runs queries against a metrics server with its credentials, each query is cancelled after a timeout
+type MetricsClient struct {
+	httpClient *http.Client
+	auth       *MetricsServerAuth
+	timeout    time.Duration
+}
+
+// NewMetricsClient returns a MetricsClient, if auth is nil queries are anonymous and if timeout is 0 the default one applies
+func NewMetricsClient(auth *MetricsServerAuth, timeout time.Duration) (*MetricsClient, error) {
+	if auth == nil {
+		auth = &MetricsServerAuth{}
+	}
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+
+	tlsConfig := &tls.Config{}
+	if len(auth.CertPEM) > 0 || len(auth.KeyPEM) > 0 {
+		certificate, err := tls.X509KeyPair(auth.CertPEM, auth.KeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	if len(auth.CAPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(auth.CAPEM) {
+			return nil, _errors.New(errorInvalidCABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := newTransport()
+	transport.TLSClientConfig = tlsConfig
+
+	return &MetricsClient{
+		httpClient: &http.Client{Transport: transport},
+		auth:       auth,
+		timeout:    timeout,
+	}, nil
+}
+
+// Returns a transport with the settings of http.DefaultTransport, built as such since Transport.Clone needs Go 1.13
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// Close closes the idle connections of the client once it's no longer used, every client has its own transport
+func (c *MetricsClient) Close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// RunMetricQuery runs a GET request to a query URL and decodes the JSON response into result
+func (c *MetricsClient) RunMetricQuery(ctx context.Context, query string, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, query, nil)
+	if err != nil {
+		return err
+	}
+	body, err := c.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// Do runs a request and returns the body of the response, it gives up when ctx is done or after the timeout.
+// Credentials are added unless the request already has an Authorization header
+func (c *MetricsClient) Do(ctx context.Context, req *http.Request) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req = req.WithContext(ctx)
+	if len(req.Header.Get("Authorization")) <= 0 {
+		if len(c.auth.BearerToken) > 0 {
+			req.Header.Set("Authorization", "Bearer "+c.auth.BearerToken)
+		} else if len(c.auth.Username) > 0 {
+			req.SetBasicAuth(c.auth.Username, c.auth.Password)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %d %s", errorMetricsServerBadStatus, resp.StatusCode, string(body))
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
@@ -2,27 +2,39 @@ package metrics
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"fmt"
 	"math"
-	"net/http"
-	"net/url"
 	"strconv"
 	"text/template"
+	"time"
 
 	_errors "errors"
 
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
 	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
-	//_util "github.com/redhat/kharon-operator/pkg/util"
+	_util "github.com/redhat/kharon-operator/pkg/util"
 )
 
 const (
 	errorQueryingMetricsServer            = "Error when querying the metrics server"
 	errorExtractingValueFromMetricsResult = "Error extracting metric value"
 	errorMountingMetricsURL               = "Error when mounting the metrics URL"
+	errorProviderNotSupported             = "Metric provider is not supported"
+	errorMultipleSeries                   = "Metric query returned more than one series and MultiSeries is not First or Merge"
 )
 
+// ErrNoData is returned when a metric query returns no series or only NaN samples
+var ErrNoData = _errors.New("Metric query returned no data")
+
+// ErrNotEnoughSamples is returned when a metric query returns less samples than MinSamples or, if the metric has
+// a RequestCountQuery, the canary served less than MinRequestCount requests
+var ErrNotEnoughSamples = _errors.New("Metric query returned not enough samples")
+
+// Seconds between samples of range queries if the metric has no Step
+const defaultStep = 15 * time.Second
+
 var log = logf.Log.WithName("canary_metrics")
 
 type Metric struct {
@@ -37,9 +49,16 @@ type Metric struct {
 	Service          string `json:"service"`
 }
 
+// QueryData is what query templates are rendered over, the Canary object plus the arguments of the metric
+type QueryData struct {
+	*kharonv1alpha1.Canary
+	Args map[string]string
+}
+
 type Result struct {
-	Metric Metric        `json:"metric"`
-	Value  []interface{} `json:"value"`
+	Metric Metric          `json:"metric"`
+	Value  []interface{}   `json:"value"`
+	Values [][]interface{} `json:"values"` // Only in range queries
 }
 
 type Data struct {
@@ -52,65 +71,239 @@ type Response struct {
 	Status string `json:"status"`
 }
 
-func RunMetricQuery(query string, result *Response) error {
-	resp, err := http.Get(query)
-	if err != nil {
-		return err
+// RenderMetricQuery renders the query of a metric, or of its template if not nil, and returns it along with the
+// provider and address of the metrics server to run it
+func RenderMetricQuery(instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric, metricTemplate *kharonv1alpha1.MetricTemplateSpec) (kharonv1alpha1.MetricProviderType, string, string, error) {
+	queryTemplate := metric.PrometheusQuery
+	provider := metric.Provider
+	metricsServer := _util.NVL(metric.Address, instance.Spec.CanaryAnalysis.MetricsServer)
+	if metricTemplate != nil {
+		queryTemplate = metricTemplate.Query
+		if len(provider) <= 0 {
+			provider = metricTemplate.Provider
+		}
+		metricsServer = _util.NVL(metric.Address, _util.NVL(metricTemplate.Address, instance.Spec.CanaryAnalysis.MetricsServer))
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-		return err
+	query, err := renderQuery(queryTemplate, instance, metric)
+	if err != nil {
+		return "", "", "", err
 	}
 
-	return nil
+	return provider, metricsServer, query, nil
 }
 
-func MountMetricQueryURL(instance *kharonv1alpha1.Canary) (string, error) {
+// Renders a query template over the canary and the arguments of a metric
+func renderQuery(queryTemplate string, instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric) (string, error) {
 	var query bytes.Buffer
-	tmpl, err := template.New("test").Parse(instance.Spec.CanaryAnalysis.Metric.PrometheusQuery)
+	tmpl, err := template.New("test").Parse(queryTemplate)
 	if err != nil {
 		return "", err
 	}
-	err = tmpl.Execute(&query, instance)
+	err = tmpl.Execute(&query, &QueryData{Canary: instance, Args: metric.TemplateArgs})
 	if err != nil {
 		return "", err
 	}
 
-	return instance.Spec.CanaryAnalysis.MetricsServer + "/api/v1/query?query=" + url.QueryEscape(query.String()), nil
+	return query.String(), nil
 }
 
-func ExtractValueFromMetricResult(result *Response) (string, error) {
-	if len(result.Data.Result) > 0 && len(result.Data.Result[0].Value) == 2 {
-		if value, ok := result.Data.Result[0].Value[1].(string); ok {
-			return value, nil
+// ExecuteRequestCountQuery runs the RequestCountQuery of a metric, with the provider and address and the Step of the
+// metric, and returns the latest value, the sum of every series if more than one
+func ExecuteRequestCountQuery(ctx context.Context, client *MetricsClient, instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric, metricTemplate *kharonv1alpha1.MetricTemplateSpec) (float64, error) {
+	providerType, metricsServer, _, err := RenderMetricQuery(instance, metric, metricTemplate)
+	if err != nil {
+		return -1, err
+	}
+	query, err := renderQuery(metric.RequestCountQuery, instance, metric)
+	if err != nil {
+		return -1, err
+	}
+	provider, err := NewMetricProvider(providerType, metricsServer, client)
+	if err != nil {
+		return -1, err
+	}
+
+	step := time.Duration(metric.Step) * time.Second
+	if step <= 0 {
+		step = defaultStep
+	}
+	series, err := provider.Query(ctx, query, 0, step)
+	if err != nil {
+		return -1, err
+	}
+	requestCount := 0.0
+	for _, samples := range series {
+		if sample, err := Reduce(samples, "last"); err == nil && !math.IsNaN(sample) {
+			requestCount += sample
 		}
 	}
 
-	return "", _errors.New("Cannot extract Value from metric result")
+	return requestCount, nil
+}
+
+// ExecuteMetricQuery runs the query of a metric, over its Window if any, and reduces its samples to one value, NaN
+// samples are skipped. It returns ErrNoData if there are no samples left or the value is NaN and ErrNotEnoughSamples
+// if there are less samples than MinSamples
+func ExecuteMetricQuery(ctx context.Context, client *MetricsClient, instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric, metricTemplate *kharonv1alpha1.MetricTemplateSpec) (float64, error) {
+	window := time.Duration(metric.Window) * time.Second
+	step := time.Duration(metric.Step) * time.Second
+	if step <= 0 {
+		step = defaultStep
+	}
+	samples, err := QueryMetricSamples(ctx, client, instance, metric, metricTemplate, window, step)
+	if err != nil {
+		return -1, err
+	}
+	samples = skipNaNSamples(samples)
+	if len(samples) <= 0 {
+		return -1, ErrNoData
+	}
+	if len(samples) < getMinSamples(metric) {
+		return -1, ErrNotEnoughSamples
+	}
+
+	metricValue, err := Reduce(samples, metric.Reducer)
+	if err != nil {
+		return -1, err
+	}
+	if math.IsNaN(metricValue) {
+		return -1, ErrNoData
+	}
+
+	return metricValue, nil
+}
+
+// QueryMetricSamples runs the query of a metric with its provider, over window if greater than 0, and returns the
+// samples of the series chosen according to the MultiSeries policy of the metric
+func QueryMetricSamples(ctx context.Context, client *MetricsClient, instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric, metricTemplate *kharonv1alpha1.MetricTemplateSpec,
+	window time.Duration, step time.Duration) ([]float64, error) {
+	providerType, metricsServer, query, err := RenderMetricQuery(instance, metric, metricTemplate)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := NewMetricProvider(providerType, metricsServer, client)
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := provider.Query(ctx, query, window, step)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) <= 0 {
+		return nil, ErrNoData
+	}
+
+	return SelectSeriesSamples(series, metric.MultiSeries)
 }
 
-func ExecuteMetricQuery(instance *kharonv1alpha1.Canary) (float64, error) {
-	if metricQueryURL, err := MountMetricQueryURL(instance); err == nil {
-		var metricResponse Response
-		if err := RunMetricQuery(metricQueryURL, &metricResponse); err == nil {
-			//_util.PrettyPrint(metricResponse)
-			if metricValue, err := ExtractValueFromMetricResult(&metricResponse); err == nil {
-				metricValueFloat := 0.0
-				if value, err := strconv.ParseFloat(metricValue, 64); err == nil {
-					if !math.IsNaN(value) {
-						metricValueFloat = value
-					}
+// ExtractSeriesFromMetricResult returns the samples of every series of a Prometheus instant (vector) or range (matrix) query result
+func ExtractSeriesFromMetricResult(result *Response) ([][]float64, error) {
+	series := [][]float64{}
+	for _, resultSeries := range result.Data.Result {
+		values := resultSeries.Values
+		if len(resultSeries.Value) == 2 {
+			values = [][]interface{}{resultSeries.Value}
+		}
+		samples := []float64{}
+		for _, value := range values {
+			if len(value) != 2 {
+				continue
+			}
+			if sample, ok := value[1].(string); ok {
+				if sample, err := strconv.ParseFloat(sample, 64); err == nil {
+					samples = append(samples, sample)
 				}
-				return metricValueFloat, nil
-			} else {
-				return -1, err
 			}
-		} else {
-			return -1, err
 		}
-	} else {
-		return -1, err
+		if len(samples) > 0 {
+			series = append(series, samples)
+		}
+	}
+	if len(series) <= 0 {
+		return nil, ErrNoData
+	}
+
+	return series, nil
+}
+
+// SelectSeriesSamples returns the samples to reduce out of several series according to a MultiSeries policy
+func SelectSeriesSamples(series [][]float64, policy kharonv1alpha1.MultiSeriesPolicy) ([]float64, error) {
+	if len(series) == 1 {
+		return series[0], nil
+	}
+
+	switch policy {
+	case kharonv1alpha1.MultiSeriesFirst:
+		return series[0], nil
+	case kharonv1alpha1.MultiSeriesMerge:
+		samples := []float64{}
+		for _, seriesSamples := range series {
+			samples = append(samples, seriesSamples...)
+		}
+		return samples, nil
+	default:
+		return nil, fmt.Errorf("%s: %d", errorMultipleSeries, len(series))
+	}
+}
+
+// GetMetrics returns the metrics of the canary analysis, Metrics or, if empty, the single Metric
+func GetMetrics(instance *kharonv1alpha1.Canary) []kharonv1alpha1.Metric {
+	if len(instance.Spec.CanaryAnalysis.Metrics) > 0 {
+		return instance.Spec.CanaryAnalysis.Metrics
+	}
+
+	return []kharonv1alpha1.Metric{instance.Spec.CanaryAnalysis.Metric}
+}
+
+// ExecuteMetricRangeQuery runs the query of a metric over a window ending now and returns its samples, NaN samples are skipped.
+// It returns ErrNoData if there are no samples left and ErrNotEnoughSamples if there are less samples than MinSamples
+func ExecuteMetricRangeQuery(ctx context.Context, client *MetricsClient, instance *kharonv1alpha1.Canary, metric *kharonv1alpha1.Metric, metricTemplate *kharonv1alpha1.MetricTemplateSpec,
+	window time.Duration, step time.Duration) ([]float64, error) {
+	series, err := QueryMetricSamples(ctx, client, instance, metric, metricTemplate, window, step)
+	if err != nil {
+		return nil, err
+	}
+	samples := skipNaNSamples(series)
+	if len(samples) <= 0 {
+		return nil, ErrNoData
 	}
+	if len(samples) < getMinSamples(metric) {
+		return nil, ErrNotEnoughSamples
+	}
+
+	return samples, nil
+}
+
+// Returns the samples that are not NaN
+func skipNaNSamples(samples []float64) []float64 {
+	numbers := []float64{}
+	for _, sample := range samples {
+		if !math.IsNaN(sample) {
+			numbers = append(numbers, sample)
+		}
+	}
+
+	return numbers
+}
+
+// Returns the samples a metric query must return, MinSamples or, if not set, 1
+func getMinSamples(metric *kharonv1alpha1.Metric) int {
+	if metric.MinSamples > 0 {
+		return int(metric.MinSamples)
+	}
+
+	return 1
+}
+
+// GetMetricComparison returns how the value of a metric is validated, if it has no operator as in its template
+func GetMetricComparison(metric *kharonv1alpha1.Metric, metricTemplate *kharonv1alpha1.MetricTemplateSpec) *Comparison {
+	if len(metric.Operator) <= 0 && metricTemplate != nil {
+		return &Comparison{Operator: metricTemplate.Operator, Threshold: metricTemplate.Threshold, Min: metricTemplate.Min, Max: metricTemplate.Max}
+	}
+
+	return &Comparison{Operator: metric.Operator, Threshold: metric.Threshold, Min: metric.Min, Max: metric.Max}
 }
 
 func ValidateMetricValue(metricValue float64, operator string, threshold float64) bool {
@@ -139,6 +332,18 @@ func ValidateMetricValue(metricValue float64, operator string, threshold float64
 				return false
 			}
 		}
+	case "eq":
+		{
+			if !(metricValue == threshold) {
+				return false
+			}
+		}
+	case "ne":
+		{
+			if !(metricValue != threshold) {
+				return false
+			}
+		}
 	default:
 		{
 			return false
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+)
+
+func TestExecuteRequestCountQuerySetsStep(t *testing.T) {
+	body := ",result,table,_time,_value\r\n" +
+		",_result,0,2019-10-01T00:00:00Z,120\r\n"
+	server := newStubServer(t, "/api/v2/query", body, func(req *http.Request) {
+		payload := map[string]string{}
+		data, _ := ioutil.ReadAll(req.Body)
+		if err := json.Unmarshal(data, &payload); err != nil || !strings.Contains(payload["query"], "windowPeriod: 15s") {
+			t.Errorf("Flux payload %s, want the default step as windowPeriod", string(data))
+		}
+	})
+	defer server.Close()
+	client, err := NewMetricsClient(nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewMetricsClient failed: %v", err)
+	}
+	defer client.Close()
+
+	instance := &kharonv1alpha1.Canary{}
+	instance.Spec.CanaryAnalysis.MetricsServer = server.URL + "?org=kharon"
+	metric := &kharonv1alpha1.Metric{Name: "requests", Provider: kharonv1alpha1.InfluxDBFluxProvider,
+		RequestCountQuery: `from(bucket: "metrics") |> aggregateWindow(every: v.windowPeriod, fn: sum)`}
+	requestCount, err := ExecuteRequestCountQuery(context.TODO(), client, instance, metric, nil)
+	if err != nil {
+		t.Fatalf("ExecuteRequestCountQuery failed: %v", err)
+	}
+	if requestCount != 120 {
+		t.Errorf("ExecuteRequestCountQuery = %v, want 120", requestCount)
+	}
+}
+
+func TestExecuteMetricQuerySkipsNaNSamples(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     string
+		minSamples int32
+		value      float64
+		err        error
+	}{
+		{"only NaN", `[1570000000,"NaN"],[1570000015,"NaN"],[1570000030,"NaN"]`, 2, -1, ErrNoData},
+		{"not enough samples but NaN", `[1570000000,"1"],[1570000015,"NaN"],[1570000030,"NaN"]`, 2, -1, ErrNotEnoughSamples},
+		{"enough samples but NaN", `[1570000000,"1"],[1570000015,"NaN"],[1570000030,"3"]`, 2, 2, nil},
+	}
+	for _, test := range tests {
+		body := `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[` + test.values + `]}]}}`
+		server := newStubServer(t, "/api/v1/query_range", body, nil)
+		client, err := NewMetricsClient(nil, time.Second)
+		if err != nil {
+			t.Fatalf("NewMetricsClient failed: %v", err)
+		}
+
+		instance := &kharonv1alpha1.Canary{}
+		instance.Spec.CanaryAnalysis.MetricsServer = server.URL
+		metric := &kharonv1alpha1.Metric{Name: "latency", PrometheusQuery: "latency", Window: 30, Reducer: ReducerAvg, MinSamples: test.minSamples}
+		value, err := ExecuteMetricQuery(context.TODO(), client, instance, metric, nil)
+		if value != test.value || err != test.err {
+			t.Errorf("%s: ExecuteMetricQuery = %v, %v, want %v, %v", test.name, value, err, test.value, test.err)
+		}
+		client.Close()
+		server.Close()
+	}
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"math"
+)
+
+// Operators comparing the value of a metric with a threshold
+const (
+	OperatorGreaterThan    = "gt"
+	OperatorGreaterOrEqual = "ge"
+	OperatorLessThan       = "lt"
+	OperatorLessOrEqual    = "le"
+	OperatorEqual          = "eq"
+	OperatorNotEqual       = "ne"
+)
+
+// Operators comparing the value of a metric with Min and Max, both included
+const (
+	OperatorBetween = "between"
+	OperatorOutside = "outside"
+)
+
+// Operators comparing the value of a metric with the value of the baseline (primary), Threshold is a percentage
+const (
+	OperatorWithin      = "within"       // At most Threshold% above or below the baseline
+	OperatorMaxIncrease = "max-increase" // At most Threshold% above the baseline
+	OperatorMaxDecrease = "max-decrease" // At most Threshold% below the baseline
+)
+
+// Comparison defines how the value of a metric is validated, with Threshold or Min and Max depending on Operator
+type Comparison struct {
+	Operator  string
+	Threshold float64
+	Min       float64
+	Max       float64
+}
+
+// IsValidOperator checks if an operator is known
+func IsValidOperator(operator string) bool {
+	return IsThresholdOperator(operator) || IsRangeOperator(operator) || IsRelativeOperator(operator)
+}
+
+// IsThresholdOperator checks if an operator compares with Threshold
+func IsThresholdOperator(operator string) bool {
+	switch operator {
+	case OperatorGreaterThan, OperatorGreaterOrEqual, OperatorLessThan, OperatorLessOrEqual, OperatorEqual, OperatorNotEqual:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRangeOperator checks if an operator compares with Min and Max
+func IsRangeOperator(operator string) bool {
+	return operator == OperatorBetween || operator == OperatorOutside
+}
+
+// IsRelativeOperator checks if an operator compares with the value of the baseline
+func IsRelativeOperator(operator string) bool {
+	switch operator {
+	case OperatorWithin, OperatorMaxIncrease, OperatorMaxDecrease:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidComparison checks if a comparison has a known operator and sensible bounds or percentage
+func IsValidComparison(comparison *Comparison) bool {
+	switch {
+	case IsRangeOperator(comparison.Operator):
+		return comparison.Min <= comparison.Max
+	case IsRelativeOperator(comparison.Operator):
+		return comparison.Threshold >= 0
+	default:
+		return IsThresholdOperator(comparison.Operator)
+	}
+}
+
+// ValidateMetricComparison checks the value of a metric, baselineValue is only used by relative operators
+func ValidateMetricComparison(metricValue float64, baselineValue float64, comparison *Comparison) bool {
+	switch {
+	case IsRangeOperator(comparison.Operator):
+		return ValidateMetricRange(metricValue, comparison.Operator, comparison.Min, comparison.Max)
+	case IsRelativeOperator(comparison.Operator):
+		return ValidateMetricRelative(metricValue, baselineValue, comparison.Operator, comparison.Threshold)
+	default:
+		return ValidateMetricValue(metricValue, comparison.Operator, comparison.Threshold)
+	}
+}
+
+// ValidateMetricRange checks the value of a metric is between, or outside, min and max
+func ValidateMetricRange(metricValue float64, operator string, min float64, max float64) bool {
+	between := metricValue >= min && metricValue <= max
+	switch operator {
+	case OperatorBetween:
+		return between
+	case OperatorOutside:
+		return !between
+	default:
+		return false
+	}
+}
+
+// ValidateMetricRelative checks the value of a metric is within a percentage of the value of the baseline
+func ValidateMetricRelative(metricValue float64, baselineValue float64, operator string, percentage float64) bool {
+	margin := math.Abs(baselineValue) * percentage / 100
+	switch operator {
+	case OperatorWithin:
+		return math.Abs(metricValue-baselineValue) <= margin
+	case OperatorMaxIncrease:
+		return metricValue <= baselineValue+margin
+	case OperatorMaxDecrease:
+		return metricValue >= baselineValue-margin
+	default:
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestValidateMetricRange(t *testing.T) {
+	tests := []struct {
+		value    float64
+		operator string
+		min      float64
+		max      float64
+		valid    bool
+	}{
+		{5, OperatorBetween, 1, 10, true},
+		{1, OperatorBetween, 1, 10, true},
+		{10, OperatorBetween, 1, 10, true},
+		{0.99, OperatorBetween, 1, 10, false},
+		{10.01, OperatorBetween, 1, 10, false},
+		{3, OperatorBetween, 3, 3, true},
+		{-5, OperatorBetween, -10, -1, true},
+		{5, OperatorOutside, 1, 10, false},
+		{1, OperatorOutside, 1, 10, false},
+		{10, OperatorOutside, 1, 10, false},
+		{0.99, OperatorOutside, 1, 10, true},
+		{10.01, OperatorOutside, 1, 10, true},
+		{5, OperatorLessThan, 1, 10, false},
+		{5, "", 1, 10, false},
+	}
+	for _, test := range tests {
+		if valid := ValidateMetricRange(test.value, test.operator, test.min, test.max); valid != test.valid {
+			t.Errorf("ValidateMetricRange(%v, %q, %v, %v) = %t, want %t", test.value, test.operator, test.min, test.max, valid, test.valid)
+		}
+	}
+}
+
+func TestValidateMetricRelative(t *testing.T) {
+	tests := []struct {
+		value      float64
+		baseline   float64
+		operator   string
+		percentage float64
+		valid      bool
+	}{
+		{105, 100, OperatorWithin, 10, true},
+		{95, 100, OperatorWithin, 10, true},
+		{110, 100, OperatorWithin, 10, true},
+		{90, 100, OperatorWithin, 10, true},
+		{111, 100, OperatorWithin, 10, false},
+		{89, 100, OperatorWithin, 10, false},
+		{-95, -100, OperatorWithin, 10, true},
+		{-111, -100, OperatorWithin, 10, false},
+		{0, 0, OperatorWithin, 10, true},
+		{0.1, 0, OperatorWithin, 10, false},
+		{100, 100, OperatorWithin, 0, true},
+		{150, 100, OperatorMaxIncrease, 50, true},
+		{151, 100, OperatorMaxIncrease, 50, false},
+		{10, 100, OperatorMaxIncrease, 50, true},
+		{50, 100, OperatorMaxDecrease, 50, true},
+		{49, 100, OperatorMaxDecrease, 50, false},
+		{1000, 100, OperatorMaxDecrease, 50, true},
+		{100, 100, OperatorBetween, 10, false},
+	}
+	for _, test := range tests {
+		if valid := ValidateMetricRelative(test.value, test.baseline, test.operator, test.percentage); valid != test.valid {
+			t.Errorf("ValidateMetricRelative(%v, %v, %q, %v) = %t, want %t", test.value, test.baseline, test.operator, test.percentage, valid, test.valid)
+		}
+	}
+}
+
+func TestValidateMetricComparison(t *testing.T) {
+	tests := []struct {
+		value      float64
+		baseline   float64
+		comparison Comparison
+		valid      bool
+	}{
+		{0.5, 0, Comparison{Operator: OperatorLessThan, Threshold: 1}, true},
+		{1, 0, Comparison{Operator: OperatorLessThan, Threshold: 1}, false},
+		{5, 0, Comparison{Operator: OperatorBetween, Min: 1, Max: 10}, true},
+		{5, 0, Comparison{Operator: OperatorOutside, Min: 1, Max: 10}, false},
+		{105, 100, Comparison{Operator: OperatorWithin, Threshold: 10}, true},
+		{105, 0, Comparison{Operator: OperatorWithin, Threshold: 10}, false},
+	}
+	for _, test := range tests {
+		if valid := ValidateMetricComparison(test.value, test.baseline, &test.comparison); valid != test.valid {
+			t.Errorf("ValidateMetricComparison(%v, %v, %+v) = %t, want %t", test.value, test.baseline, test.comparison, valid, test.valid)
+		}
+	}
+}
+
+func TestIsValidComparison(t *testing.T) {
+	tests := []struct {
+		comparison Comparison
+		valid      bool
+	}{
+		{Comparison{Operator: OperatorGreaterOrEqual, Threshold: -1}, true},
+		{Comparison{Operator: OperatorBetween, Min: 1, Max: 10}, true},
+		{Comparison{Operator: OperatorOutside, Min: 3, Max: 3}, true},
+		{Comparison{Operator: OperatorBetween, Min: 10, Max: 1}, false},
+		{Comparison{Operator: OperatorWithin, Threshold: 0}, true},
+		{Comparison{Operator: OperatorMaxIncrease, Threshold: -10}, false},
+		{Comparison{Operator: ""}, false},
+		{Comparison{Operator: "gte"}, false},
+	}
+	for _, test := range tests {
+		if valid := IsValidComparison(&test.comparison); valid != test.valid {
+			t.Errorf("IsValidComparison(%+v) = %t, want %t", test.comparison, valid, test.valid)
+		}
+	}
+}
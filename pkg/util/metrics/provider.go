@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+)
+
+// Window of instant queries to providers that only support time ranges
+const defaultInstantWindow = time.Minute
+
+// MetricProvider runs queries against a metrics backend, each backend (Prometheus, Datadog...) implements it using its own API
+type MetricProvider interface {
+	// Query runs a query and returns the samples of every series it returns, if window is greater than 0 over a
+	// window ending now sampled every step, otherwise only the latest samples
+	Query(ctx context.Context, query string, window time.Duration, step time.Duration) ([][]float64, error)
+}
+
+// NewMetricProvider returns the MetricProvider for a type of provider, if empty Prometheus
+func NewMetricProvider(providerType kharonv1alpha1.MetricProviderType, address string, client *MetricsClient) (MetricProvider, error) {
+	switch providerType {
+	case kharonv1alpha1.PrometheusProvider, "":
+		return &PrometheusProvider{address: address, client: client}, nil
+	case kharonv1alpha1.DatadogProvider:
+		return &DatadogProvider{address: address, client: client}, nil
+	case kharonv1alpha1.InfluxDBProvider:
+		return &InfluxDBProvider{address: address, client: client}, nil
+	case kharonv1alpha1.InfluxDBFluxProvider:
+		return &InfluxDBFluxProvider{address: address, client: client}, nil
+	case kharonv1alpha1.GraphiteProvider:
+		return &GraphiteProvider{address: address, client: client}, nil
+	default:
+		return nil, fmt.Errorf("%s: %s", errorProviderNotSupported, providerType)
+	}
+}
+
+// IsValidProvider checks if a type of provider is supported
+func IsValidProvider(providerType kharonv1alpha1.MetricProviderType) bool {
+	_, err := NewMetricProvider(providerType, "", nil)
+	return err == nil
+}
+
+// Returns the URL of an API path of a provider address, query parameters in the address are kept
+func getProviderURL(address string, path string, params url.Values) (string, error) {
+	providerURL, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	values := providerURL.Query()
+	for key := range params {
+		values.Set(key, params.Get(key))
+	}
+	providerURL.Path = providerURL.Path + path
+	providerURL.RawQuery = values.Encode()
+
+	return providerURL.String(), nil
+}
+
+// Returns the start of the time range of a query, instant queries look at the last minute
+func getQueryStart(end time.Time, window time.Duration) time.Time {
+	if window <= 0 {
+		return end.Add(-defaultInstantWindow)
+	}
+
+	return end.Add(-window)
+}
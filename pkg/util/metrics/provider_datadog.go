@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	_errors "errors"
+)
+
+// blank assignment to verify that DatadogProvider implements MetricProvider
+var _ MetricProvider = &DatadogProvider{}
+
+// DatadogProvider runs queries using the Datadog timeseries API (api/v1/query), the address is the Datadog
+// site (https://api.datadoghq.com...) and credentials are the API and application keys
+type DatadogProvider struct {
+	address string
+	client  *MetricsClient
+}
+
+// DatadogSeries is a series of a Datadog query response, points are [timestamp, value] with null values
+type DatadogSeries struct {
+	Metric    string       `json:"metric"`
+	PointList [][]*float64 `json:"pointlist"`
+}
+
+// DatadogResponse is the response of a Datadog query
+type DatadogResponse struct {
+	Status string          `json:"status"`
+	Error  string          `json:"error"`
+	Series []DatadogSeries `json:"series"`
+}
+
+// Query runs a query over window, or the last minute for instant queries, Datadog chooses the resolution
+func (p *DatadogProvider) Query(ctx context.Context, query string, window time.Duration, step time.Duration) ([][]float64, error) {
+	end := time.Now()
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("from", strconv.FormatInt(getQueryStart(end, window).Unix(), 10))
+	params.Set("to", strconv.FormatInt(end.Unix(), 10))
+	queryURL, err := getProviderURL(p.address, "/api/v1/query", params)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, queryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("DD-API-KEY", p.client.auth.APIKey)
+	req.Header.Set("DD-APPLICATION-KEY", p.client.auth.ApplicationKey)
+	body, err := p.client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var response DatadogResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Error) > 0 {
+		return nil, _errors.New(response.Error)
+	}
+
+	series := [][]float64{}
+	for _, responseSeries := range response.Series {
+		samples := []float64{}
+		for _, point := range responseSeries.PointList {
+			if len(point) == 2 && point[1] != nil {
+				samples = append(samples, *point[1])
+			}
+		}
+		if len(samples) > 0 {
+			series = append(series, samples)
+		}
+	}
+
+	return series, nil
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// blank assignment to verify that GraphiteProvider implements MetricProvider
+var _ MetricProvider = &GraphiteProvider{}
+
+// GraphiteProvider runs target expressions using the Graphite render API (/render)
+type GraphiteProvider struct {
+	address string
+	client  *MetricsClient
+}
+
+// GraphiteSeries is a series of a Graphite render response, datapoints are [value, timestamp] with null values
+type GraphiteSeries struct {
+	Target     string       `json:"target"`
+	DataPoints [][]*float64 `json:"datapoints"`
+}
+
+// Query renders a target over window, or the last minute for instant queries, Graphite chooses the resolution
+func (p *GraphiteProvider) Query(ctx context.Context, query string, window time.Duration, step time.Duration) ([][]float64, error) {
+	if window <= 0 {
+		window = defaultInstantWindow
+	}
+	params := url.Values{}
+	params.Set("target", query)
+	params.Set("from", "-"+strconv.FormatInt(int64(window.Seconds()), 10)+"s")
+	params.Set("until", "now")
+	params.Set("format", "json")
+	queryURL, err := getProviderURL(p.address, "/render", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var response []GraphiteSeries
+	if err := p.client.RunMetricQuery(ctx, queryURL, &response); err != nil {
+		return nil, err
+	}
+
+	series := [][]float64{}
+	for _, responseSeries := range response {
+		samples := []float64{}
+		for _, point := range responseSeries.DataPoints {
+			if len(point) == 2 && point[0] != nil {
+				samples = append(samples, *point[0])
+			}
+		}
+		if len(samples) > 0 {
+			series = append(series, samples)
+		}
+	}
+
+	return series, nil
+}
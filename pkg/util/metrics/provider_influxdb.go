@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	_errors "errors"
+)
+
+// blank assignments to verify that the InfluxDB providers implement MetricProvider
+var _ MetricProvider = &InfluxDBProvider{}
+var _ MetricProvider = &InfluxDBFluxProvider{}
+
+// InfluxDBProvider runs InfluxQL queries using the InfluxDB 1.x API (/query), the database is set with a db
+// query parameter in the address. The time range is part of the query, e.g. WHERE time > now() - 5m
+type InfluxDBProvider struct {
+	address string
+	client  *MetricsClient
+}
+
+// InfluxDBFluxProvider runs Flux queries using the InfluxDB 2.x API (/api/v2/query), the organization is set with
+// an org query parameter in the address and the token is the bearer token of the metrics server secret.
+// Queries may use v.timeRangeStart, v.timeRangeStop and v.windowPeriod which are set from the window and step
+type InfluxDBFluxProvider struct {
+	address string
+	client  *MetricsClient
+}
+
+// InfluxDBSeries is a series of an InfluxQL response, values are rows of the columns
+type InfluxDBSeries struct {
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Values  [][]interface{} `json:"values"`
+}
+
+// InfluxDBResult is the result of one InfluxQL statement
+type InfluxDBResult struct {
+	Series []InfluxDBSeries `json:"series"`
+	Error  string           `json:"error"`
+}
+
+// InfluxDBResponse is the response of an InfluxQL query
+type InfluxDBResponse struct {
+	Results []InfluxDBResult `json:"results"`
+	Error   string           `json:"error"`
+}
+
+// Query runs an InfluxQL query, window and step are ignored as InfluxQL sets them in the query
+func (p *InfluxDBProvider) Query(ctx context.Context, query string, window time.Duration, step time.Duration) ([][]float64, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("epoch", "s")
+	queryURL, err := getProviderURL(p.address, "/query", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var response InfluxDBResponse
+	if err := p.client.RunMetricQuery(ctx, queryURL, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Error) > 0 {
+		return nil, _errors.New(response.Error)
+	}
+
+	series := [][]float64{}
+	for _, result := range response.Results {
+		if len(result.Error) > 0 {
+			return nil, _errors.New(result.Error)
+		}
+		for _, resultSeries := range result.Series {
+			// The value is the first column which is not the time
+			column := -1
+			for i, name := range resultSeries.Columns {
+				if name != "time" {
+					column = i
+					break
+				}
+			}
+			if column < 0 {
+				continue
+			}
+			samples := []float64{}
+			for _, row := range resultSeries.Values {
+				if len(row) <= column {
+					continue
+				}
+				if sample, ok := row[column].(float64); ok {
+					samples = append(samples, sample)
+				}
+			}
+			if len(samples) > 0 {
+				series = append(series, samples)
+			}
+		}
+	}
+
+	return series, nil
+}
+
+// Query runs a Flux query, the samples of each table of the result are a series
+func (p *InfluxDBFluxProvider) Query(ctx context.Context, query string, window time.Duration, step time.Duration) ([][]float64, error) {
+	queryURL, err := getProviderURL(p.address, "/api/v2/query", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		window = defaultInstantWindow
+	}
+	query = fmt.Sprintf("option v = {timeRangeStart: -%ds, timeRangeStop: now(), windowPeriod: %ds}\n%s", int64(window.Seconds()), int64(step.Seconds()), query)
+	payload, err := json.Marshal(map[string]string{"query": query, "type": "flux"})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, queryURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+	if len(p.client.auth.BearerToken) > 0 {
+		req.Header.Set("Authorization", "Token "+p.client.auth.BearerToken)
+	}
+	body, err := p.client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractSeriesFromFluxResult(body)
+}
+
+// Returns the _value column of an annotated CSV Flux result grouped by result and table. Every result, and every
+// group of tables of a result with different columns, starts with a header row whose first column is empty
+func extractSeriesFromFluxResult(body []byte) ([][]float64, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	series := [][]float64{}
+	tables := map[string]int{}
+	headers := 0
+	valueColumn, resultColumn, tableColumn := -1, -1, -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isFluxHeader(record) {
+			headers++
+			valueColumn, resultColumn, tableColumn = -1, -1, -1
+			for i, name := range record {
+				switch name {
+				case "_value":
+					valueColumn = i
+				case "result":
+					resultColumn = i
+				case "table":
+					tableColumn = i
+				}
+			}
+			continue
+		}
+		if valueColumn < 0 || len(record) <= valueColumn {
+			continue
+		}
+		sample, err := strconv.ParseFloat(record[valueColumn], 64)
+		if err != nil {
+			continue
+		}
+		// Results named by a default annotation have an empty result column, then their header tells them apart
+		result := strconv.Itoa(headers)
+		if resultColumn >= 0 && len(record) > resultColumn && len(record[resultColumn]) > 0 {
+			result = record[resultColumn]
+		}
+		table := ""
+		if tableColumn >= 0 && len(record) > tableColumn {
+			table = record[tableColumn]
+		}
+		key := result + "/" + table
+		index, ok := tables[key]
+		if !ok {
+			index = len(series)
+			tables[key] = index
+			series = append(series, []float64{})
+		}
+		series[index] = append(series[index], sample)
+	}
+
+	return series, nil
+}
+
+// Header rows of an annotated CSV Flux result have an empty first column, the annotation one, and name the result and table columns
+func isFluxHeader(record []string) bool {
+	if len(record) <= 1 || len(record[0]) > 0 {
+		return false
+	}
+	for _, name := range record[1:] {
+		if name == "result" || name == "table" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// blank assignment to verify that PrometheusProvider implements MetricProvider
+var _ MetricProvider = &PrometheusProvider{}
+
+// PrometheusProvider runs PromQL queries using the Prometheus HTTP API, Thanos Querier exposes the same API
+type PrometheusProvider struct {
+	address string
+	client  *MetricsClient
+}
+
+// Query runs an instant query or, if window is greater than 0, a range query
+func (p *PrometheusProvider) Query(ctx context.Context, query string, window time.Duration, step time.Duration) ([][]float64, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	path := "/api/v1/query"
+	if window > 0 {
+		end := time.Now()
+		params.Set("start", strconv.FormatInt(getQueryStart(end, window).Unix(), 10))
+		params.Set("end", strconv.FormatInt(end.Unix(), 10))
+		params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+		path = "/api/v1/query_range"
+	}
+	queryURL, err := getProviderURL(p.address, path, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var metricResponse Response
+	if err := p.client.RunMetricQuery(ctx, queryURL, &metricResponse); err != nil {
+		return nil, err
+	}
+
+	return ExtractSeriesFromMetricResult(&metricResponse)
+}
@@ -0,0 +1,261 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	kharonv1alpha1 "github.com/redhat/kharon-operator/pkg/apis/kharon/v1alpha1"
+)
+
+// Starts a stub metrics server answering body to requests to path, check can fail the test looking at the request
+func newStubServer(t *testing.T, path string, body string, check func(*http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != path {
+			t.Errorf("Request to %s, want %s", req.URL.Path, path)
+			http.NotFound(w, req)
+			return
+		}
+		if check != nil {
+			check(req)
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+// Runs a query with a provider of a type against a stub metrics server
+func queryStubServer(t *testing.T, providerType kharonv1alpha1.MetricProviderType, server *httptest.Server, auth *MetricsServerAuth,
+	query string, window time.Duration, step time.Duration) ([][]float64, error) {
+	client, err := NewMetricsClient(auth, time.Second)
+	if err != nil {
+		t.Fatalf("NewMetricsClient failed: %v", err)
+	}
+	defer client.Close()
+	provider, err := NewMetricProvider(providerType, server.URL, client)
+	if err != nil {
+		t.Fatalf("NewMetricProvider(%s) failed: %v", providerType, err)
+	}
+
+	return provider.Query(context.TODO(), query, window, step)
+}
+
+func TestPrometheusProviderInstantQuery(t *testing.T) {
+	body := `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"pod":"a"},"value":[1570000000,"0.5"]},
+		{"metric":{"pod":"b"},"value":[1570000000,"NaN"]},
+		{"metric":{"pod":"c"},"value":[1570000000,"1.5"]}]}}`
+	server := newStubServer(t, "/api/v1/query", body, func(req *http.Request) {
+		if query := req.URL.Query().Get("query"); query != "up" {
+			t.Errorf("Query %q, want up", query)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Authorization %q, want Bearer secret", auth)
+		}
+	})
+	defer server.Close()
+
+	series, err := queryStubServer(t, kharonv1alpha1.PrometheusProvider, server, &MetricsServerAuth{BearerToken: "secret"}, "up", 0, 0)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(series) != 3 || series[0][0] != 0.5 || series[2][0] != 1.5 {
+		t.Errorf("Query returned %v, want [[0.5] [NaN] [1.5]]", series)
+	}
+}
+
+func TestPrometheusProviderRangeQuery(t *testing.T) {
+	body := `{"status":"success","data":{"resultType":"matrix","result":[
+		{"metric":{},"values":[[1570000000,"1"],[1570000015,"2"],[1570000030,"3"]]}]}}`
+	server := newStubServer(t, "/api/v1/query_range", body, func(req *http.Request) {
+		params := req.URL.Query()
+		if params.Get("step") != "15" || len(params.Get("start")) <= 0 || len(params.Get("end")) <= 0 {
+			t.Errorf("Range query parameters %v, want start, end and step 15", params)
+		}
+	})
+	defer server.Close()
+
+	series, err := queryStubServer(t, "", server, nil, "rate(errors[1m])", time.Minute, 15*time.Second)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !reflect.DeepEqual(series, [][]float64{{1, 2, 3}}) {
+		t.Errorf("Query returned %v, want [[1 2 3]]", series)
+	}
+}
+
+func TestPrometheusProviderNoData(t *testing.T) {
+	server := newStubServer(t, "/api/v1/query", `{"status":"success","data":{"resultType":"vector","result":[]}}`, nil)
+	defer server.Close()
+
+	if _, err := queryStubServer(t, kharonv1alpha1.PrometheusProvider, server, nil, "up", 0, 0); err != ErrNoData {
+		t.Errorf("Query of an empty result returned %v, want ErrNoData", err)
+	}
+}
+
+func TestDatadogProvider(t *testing.T) {
+	body := `{"status":"ok","series":[
+		{"metric":"errors","pointlist":[[1570000000000,1.0],[1570000015000,null],[1570000030000,3.0]]},
+		{"metric":"errors","pointlist":[[1570000000000,null]]},
+		{"metric":"errors","pointlist":[[1570000000000,5.0]]}]}`
+	server := newStubServer(t, "/api/v1/query", body, func(req *http.Request) {
+		if req.Header.Get("DD-API-KEY") != "api" || req.Header.Get("DD-APPLICATION-KEY") != "app" {
+			t.Errorf("Datadog keys %q and %q, want api and app", req.Header.Get("DD-API-KEY"), req.Header.Get("DD-APPLICATION-KEY"))
+		}
+		params := req.URL.Query()
+		if params.Get("query") != "sum:errors{*}" || len(params.Get("from")) <= 0 || len(params.Get("to")) <= 0 {
+			t.Errorf("Datadog parameters %v, want query, from and to", params)
+		}
+	})
+	defer server.Close()
+
+	series, err := queryStubServer(t, kharonv1alpha1.DatadogProvider, server, &MetricsServerAuth{APIKey: "api", ApplicationKey: "app"}, "sum:errors{*}", 0, 0)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !reflect.DeepEqual(series, [][]float64{{1, 3}, {5}}) {
+		t.Errorf("Query returned %v, want [[1 3] [5]]", series)
+	}
+}
+
+func TestDatadogProviderError(t *testing.T) {
+	server := newStubServer(t, "/api/v1/query", `{"status":"error","error":"bad query"}`, nil)
+	defer server.Close()
+
+	if _, err := queryStubServer(t, kharonv1alpha1.DatadogProvider, server, nil, "bad", 0, 0); err == nil || err.Error() != "bad query" {
+		t.Errorf("Query returned error %v, want bad query", err)
+	}
+}
+
+func TestInfluxDBProvider(t *testing.T) {
+	body := `{"results":[{"statement_id":0,"series":[
+		{"name":"errors","columns":["time","mean"],"values":[[1570000000,1.5],[1570000015,null],[1570000030,2.5]]},
+		{"name":"latency","columns":["time","p99"],"values":[[1570000000,100]]}]}]}`
+	server := newStubServer(t, "/query", body, func(req *http.Request) {
+		params := req.URL.Query()
+		if params.Get("q") != "SELECT mean(value) FROM errors" || params.Get("db") != "telegraf" || params.Get("epoch") != "s" {
+			t.Errorf("InfluxQL parameters %v, want q, db telegraf and epoch s", params)
+		}
+	})
+	defer server.Close()
+	server.URL += "?db=telegraf"
+
+	series, err := queryStubServer(t, kharonv1alpha1.InfluxDBProvider, server, nil, "SELECT mean(value) FROM errors", 0, 0)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !reflect.DeepEqual(series, [][]float64{{1.5, 2.5}, {100}}) {
+		t.Errorf("Query returned %v, want [[1.5 2.5] [100]]", series)
+	}
+}
+
+func TestInfluxDBProviderError(t *testing.T) {
+	server := newStubServer(t, "/query", `{"results":[{"statement_id":0,"error":"database not found"}]}`, nil)
+	defer server.Close()
+
+	if _, err := queryStubServer(t, kharonv1alpha1.InfluxDBProvider, server, nil, "SELECT 1", 0, 0); err == nil || err.Error() != "database not found" {
+		t.Errorf("Query returned error %v, want database not found", err)
+	}
+}
+
+func TestInfluxDBFluxProvider(t *testing.T) {
+	// Two results with the same table IDs and the _value column in a different place, separated by an empty line
+	body := "#datatype,string,long,dateTime:RFC3339,double,string\r\n" +
+		"#group,false,false,false,false,true\r\n" +
+		"#default,_result,,,,\r\n" +
+		",result,table,_time,_value,_field\r\n" +
+		",,0,2019-10-01T00:00:00Z,1,errors\r\n" +
+		",,0,2019-10-01T00:00:15Z,2,errors\r\n" +
+		",,1,2019-10-01T00:00:00Z,10,errors\r\n" +
+		"\r\n" +
+		"#datatype,string,long,double,dateTime:RFC3339\r\n" +
+		"#group,false,false,false,false\r\n" +
+		"#default,,,,\r\n" +
+		",result,table,_value,_time\r\n" +
+		",latency,0,100,2019-10-01T00:00:00Z\r\n" +
+		",latency,0,200,2019-10-01T00:00:15Z\r\n"
+	server := newStubServer(t, "/api/v2/query", body, func(req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Query().Get("org") != "kharon" {
+			t.Errorf("Flux request %s %s, want POST with org kharon", req.Method, req.URL)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Token secret" {
+			t.Errorf("Authorization %q, want Token secret", auth)
+		}
+		payload := map[string]string{}
+		data, _ := ioutil.ReadAll(req.Body)
+		if err := json.Unmarshal(data, &payload); err != nil || payload["type"] != "flux" ||
+			!strings.Contains(payload["query"], "timeRangeStart: -300s") || !strings.HasSuffix(payload["query"], `from(bucket: "metrics")`) {
+			t.Errorf("Flux payload %s, want the query with its time range options", string(data))
+		}
+	})
+	defer server.Close()
+	server.URL += "?org=kharon"
+
+	series, err := queryStubServer(t, kharonv1alpha1.InfluxDBFluxProvider, server, &MetricsServerAuth{BearerToken: "secret"}, `from(bucket: "metrics")`, 5*time.Minute, 15*time.Second)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !reflect.DeepEqual(series, [][]float64{{1, 2}, {10}, {100, 200}}) {
+		t.Errorf("Query returned %v, want [[1 2] [10] [100 200]]", series)
+	}
+}
+
+func TestExtractSeriesFromFluxResultDefaultResults(t *testing.T) {
+	// Results named by default annotations only, the header of each one tells them apart
+	body := "#default,_result,,,\n" +
+		",result,table,_time,_value\n" +
+		",,0,2019-10-01T00:00:00Z,1\n" +
+		"\n" +
+		"#default,_other,,,\n" +
+		",result,table,_value,_time\n" +
+		",,0,5,2019-10-01T00:00:00Z\n"
+
+	series, err := extractSeriesFromFluxResult([]byte(body))
+	if err != nil {
+		t.Fatalf("extractSeriesFromFluxResult failed: %v", err)
+	}
+	if !reflect.DeepEqual(series, [][]float64{{1}, {5}}) {
+		t.Errorf("extractSeriesFromFluxResult returned %v, want [[1] [5]]", series)
+	}
+}
+
+func TestGraphiteProvider(t *testing.T) {
+	body := `[
+		{"target":"errors.a","datapoints":[[1.0,1570000000],[null,1570000015],[2.0,1570000030]]},
+		{"target":"errors.b","datapoints":[[null,1570000000]]},
+		{"target":"errors.c","datapoints":[[4.0,1570000000]]}]`
+	server := newStubServer(t, "/render", body, func(req *http.Request) {
+		params := req.URL.Query()
+		if params.Get("target") != "errors.*" || params.Get("from") != "-60s" || params.Get("until") != "now" || params.Get("format") != "json" {
+			t.Errorf("Graphite parameters %v, want target, from -60s, until now and format json", params)
+		}
+	})
+	defer server.Close()
+
+	series, err := queryStubServer(t, kharonv1alpha1.GraphiteProvider, server, nil, "errors.*", 0, 0)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !reflect.DeepEqual(series, [][]float64{{1, 2}, {4}}) {
+		t.Errorf("Query returned %v, want [[1 2] [4]]", series)
+	}
+}
+
+func TestProviderBadStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	for _, providerType := range []kharonv1alpha1.MetricProviderType{kharonv1alpha1.PrometheusProvider, kharonv1alpha1.DatadogProvider,
+		kharonv1alpha1.InfluxDBProvider, kharonv1alpha1.InfluxDBFluxProvider, kharonv1alpha1.GraphiteProvider} {
+		if _, err := queryStubServer(t, providerType, server, nil, "up", 0, 0); err == nil || !strings.HasPrefix(err.Error(), errorMetricsServerBadStatus) {
+			t.Errorf("%s query returned error %v, want %s", providerType, err, errorMetricsServerBadStatus)
+		}
+	}
+}
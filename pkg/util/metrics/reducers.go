@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	_errors "errors"
+)
+
+const (
+	errorReducerNotSupported = "Metric reducer is not supported"
+)
+
+// Reducers of the samples of a query to one value, percentiles are written as p followed by a number (p50, p99.9...)
+const (
+	ReducerAvg  = "avg"
+	ReducerMax  = "max"
+	ReducerMin  = "min"
+	ReducerLast = "last"
+)
+
+// Reduce reduces samples to one value, NaN samples are ignored and if there's no other sample the result is NaN.
+// If reducer is empty the last sample is taken
+func Reduce(samples []float64, reducer string) (float64, error) {
+	values := []float64{}
+	for _, sample := range samples {
+		if !math.IsNaN(sample) {
+			values = append(values, sample)
+		}
+	}
+
+	switch reducer {
+	case ReducerLast, "":
+		if len(values) <= 0 {
+			return math.NaN(), nil
+		}
+		return values[len(values)-1], nil
+	case ReducerAvg:
+		if len(values) <= 0 {
+			return math.NaN(), nil
+		}
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		return sum / float64(len(values)), nil
+	case ReducerMax:
+		result := math.NaN()
+		for _, value := range values {
+			if math.IsNaN(result) || value > result {
+				result = value
+			}
+		}
+		return result, nil
+	case ReducerMin:
+		result := math.NaN()
+		for _, value := range values {
+			if math.IsNaN(result) || value < result {
+				result = value
+			}
+		}
+		return result, nil
+	default:
+		percentile, ok := parsePercentile(reducer)
+		if !ok {
+			return math.NaN(), _errors.New(errorReducerNotSupported)
+		}
+		return Percentile(values, percentile), nil
+	}
+}
+
+// IsValidReducer checks if a reducer is supported
+func IsValidReducer(reducer string) bool {
+	_, err := Reduce([]float64{}, reducer)
+	return err == nil
+}
+
+// Percentile returns the percentile (0-100) of some values interpolating between the closest ranks, NaN if there are none
+func Percentile(values []float64, percentile float64) float64 {
+	if len(values) <= 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	rank := percentile / 100.0 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// Parses a percentile reducer like p99, the percentile has to be between 0 and 100, so not NaN nor infinite
+func parsePercentile(reducer string) (float64, bool) {
+	if !strings.HasPrefix(reducer, "p") {
+		return 0, false
+	}
+	percentile, err := strconv.ParseFloat(strings.TrimPrefix(reducer, "p"), 64)
+	if err != nil || math.IsNaN(percentile) || math.IsInf(percentile, 0) || percentile < 0 || percentile > 100 {
+		return 0, false
+	}
+
+	return percentile, true
+}
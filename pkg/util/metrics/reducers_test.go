@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     []float64
+		percentile float64
+		result     float64
+	}{
+		{"no values", nil, 50, math.NaN()},
+		{"one value", []float64{3}, 99, 3},
+		{"p0 is the min", []float64{5, 1, 3}, 0, 1},
+		{"p100 is the max", []float64{5, 1, 3}, 100, 5},
+		{"p50 of odd values", []float64{5, 1, 3}, 50, 3},
+		{"p50 of even values interpolates", []float64{4, 1, 3, 2}, 50, 2.5},
+		{"p90 interpolates", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 90, 9.1},
+		{"ties", []float64{2, 2, 2, 8}, 50, 2},
+	}
+	for _, test := range tests {
+		result := Percentile(test.values, test.percentile)
+		if !sameValue(result, test.result) {
+			t.Errorf("%s: Percentile(%v, %v) = %v, want %v", test.name, test.values, test.percentile, result, test.result)
+		}
+	}
+}
+
+func TestReduce(t *testing.T) {
+	samples := []float64{4, math.NaN(), 1, 3, 2}
+	tests := []struct {
+		name    string
+		samples []float64
+		reducer string
+		result  float64
+	}{
+		{"empty reducer is last", samples, "", 2},
+		{"last", samples, ReducerLast, 2},
+		{"avg skips NaN", samples, ReducerAvg, 2.5},
+		{"max", samples, ReducerMax, 4},
+		{"min", samples, ReducerMin, 1},
+		{"p50", samples, "p50", 2.5},
+		{"decimal percentile", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, "p99.9", 9.991},
+		{"last of NaN only", []float64{math.NaN()}, ReducerLast, math.NaN()},
+		{"avg of no samples", nil, ReducerAvg, math.NaN()},
+		{"max of no samples", nil, ReducerMax, math.NaN()},
+		{"min of NaN only", []float64{math.NaN(), math.NaN()}, ReducerMin, math.NaN()},
+		{"percentile of no samples", nil, "p99", math.NaN()},
+	}
+	for _, test := range tests {
+		result, err := Reduce(test.samples, test.reducer)
+		if err != nil {
+			t.Errorf("%s: Reduce(%v, %q) failed: %v", test.name, test.samples, test.reducer, err)
+			continue
+		}
+		if !sameValue(result, test.result) {
+			t.Errorf("%s: Reduce(%v, %q) = %v, want %v", test.name, test.samples, test.reducer, result, test.result)
+		}
+	}
+}
+
+func TestReduceRejectsUnknownReducers(t *testing.T) {
+	for _, reducer := range []string{"median", "p", "p101", "p-1", "pxx", "P99", "pNaN", "pnan", "pInf", "p-Inf", "pinfinity"} {
+		if _, err := Reduce([]float64{1}, reducer); err == nil {
+			t.Errorf("Reduce with reducer %q didn't fail", reducer)
+		}
+		if IsValidReducer(reducer) {
+			t.Errorf("IsValidReducer(%q) = true, want false", reducer)
+		}
+	}
+}
+
+// Values are the same if both are NaN or they're equal but for rounding errors
+func sameValue(value float64, expected float64) bool {
+	if math.IsNaN(expected) {
+		return math.IsNaN(value)
+	}
+
+	return math.Abs(value-expected) < 1e-9
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// MannWhitneyU runs a one-sided Mann-Whitney U test and returns the p-value of samples being greater than
+// baseline samples. It uses the normal approximation with tie and continuity corrections, which needs a
+// handful of samples on each side to be meaningful
+func MannWhitneyU(baseline []float64, samples []float64) float64 {
+	n1 := float64(len(baseline))
+	n2 := float64(len(samples))
+	if n1 <= 0 || n2 <= 0 {
+		return 1
+	}
+
+	type rankedSample struct {
+		value  float64
+		sample bool
+	}
+	all := make([]rankedSample, 0, len(baseline)+len(samples))
+	for _, value := range baseline {
+		all = append(all, rankedSample{value: value})
+	}
+	for _, value := range samples {
+		all = append(all, rankedSample{value: value, sample: true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// Rank samples, ties get the average of their ranks
+	n := n1 + n2
+	rankSum := 0.0
+	ties := 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2.0
+		for k := i; k < j; k++ {
+			if all[k].sample {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	u := rankSum - n2*(n2+1)/2.0
+	mean := n1 * n2 / 2.0
+	sigma := math.Sqrt(n1 * n2 / 12.0 * ((n + 1) - ties/(n*(n-1))))
+	if sigma <= 0 {
+		// Every value is the same, samples cannot be greater than baseline
+		return 1
+	}
+	z := (u - mean - 0.5) / sigma
+
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// Median returns the median of some samples, 0 if there are none
+func Median(samples []float64) float64 {
+	if len(samples) <= 0 {
+		return 0
+	}
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2.0
+	}
+
+	return sorted[middle]
+}
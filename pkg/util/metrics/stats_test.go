@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseline []float64
+		samples  []float64
+		pValue   float64
+	}{
+		{"samples greater", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 0.006092890177672409},
+		{"samples lower", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 0.9966923245172357},
+		{"samples shuffled", []float64{3, 1, 5, 2, 4}, []float64{9, 6, 10, 8, 7}, 0.006092890177672409},
+		{"ties across both sides", []float64{1, 1, 2, 2}, []float64{2, 2, 3, 3}, 0.04317936982350622},
+		{"identical samples", []float64{4, 4, 4, 4}, []float64{4, 4, 4}, 1},
+		{"one sample each", []float64{1}, []float64{2}, 0.5},
+		{"one identical sample each", []float64{1}, []float64{1}, 1},
+		{"no baseline", []float64{}, []float64{1, 2}, 1},
+		{"no samples", []float64{1, 2}, nil, 1},
+	}
+	for _, test := range tests {
+		if pValue := MannWhitneyU(test.baseline, test.samples); math.Abs(pValue-test.pValue) > 1e-9 {
+			t.Errorf("%s: MannWhitneyU(%v, %v) = %v, want %v", test.name, test.baseline, test.samples, pValue, test.pValue)
+		}
+	}
+}
+
+func TestMannWhitneyUIsOneSided(t *testing.T) {
+	baseline := []float64{10, 12, 11, 13, 12, 11, 10, 12}
+	samples := []float64{20, 22, 21, 23, 22, 21, 20, 22}
+	greater := MannWhitneyU(baseline, samples)
+	lower := MannWhitneyU(samples, baseline)
+	if greater >= 0.05 || lower <= 0.95 {
+		t.Errorf("MannWhitneyU greater = %v, lower = %v, want greater < 0.05 and lower > 0.95", greater, lower)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float64
+		median  float64
+	}{
+		{"no samples", nil, 0},
+		{"one sample", []float64{7}, 7},
+		{"odd samples", []float64{3, 1, 2}, 2},
+		{"even samples", []float64{4, 1, 3, 2}, 2.5},
+		{"ties", []float64{5, 5, 1, 5}, 5},
+	}
+	for _, test := range tests {
+		samples := append([]float64{}, test.samples...)
+		if median := Median(test.samples); median != test.median {
+			t.Errorf("%s: Median(%v) = %v, want %v", test.name, test.samples, median, test.median)
+		}
+		for i := range samples {
+			if samples[i] != test.samples[i] {
+				t.Errorf("%s: Median sorted its samples in place", test.name)
+				break
+			}
+		}
+	}
+}
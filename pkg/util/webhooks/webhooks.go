@@ -0,0 +1,83 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	errorWebhookBadStatus = "Webhook returned a non 2xx status"
+)
+
+// Seconds before a call to a webhook is cancelled if no timeout is set
+const defaultWebhookTimeout = 10 * time.Second
+
+// Payload is what is POSTed to webhooks
+type Payload struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Target    string            `json:"target"`
+	Weight    int32             `json:"weight"`
+	Iteration int32             `json:"iteration"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Hook      string            `json:"hook,omitempty"` // Only in calls to hooks, their type
+}
+
+// Response is the optional body of the response of a webhook, a missing pass field means the check passed
+type Response struct {
+	Pass *bool `json:"pass"`
+}
+
+// CallWebhook POSTs payload as JSON to url and returns the body of the response, a non 2xx status is an error
+func CallWebhook(ctx context.Context, url string, timeout time.Duration, payload interface{}) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %d %s", errorWebhookBadStatus, resp.StatusCode, string(body))
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// RunWebhookCheck calls a webhook check and returns if it passed, the response must be 2xx and not {"pass": false}
+func RunWebhookCheck(ctx context.Context, url string, timeout time.Duration, payload *Payload) (bool, error) {
+	body, err := CallWebhook(ctx, url, timeout, payload)
+	if err != nil {
+		return false, err
+	}
+
+	var response Response
+	if len(bytes.TrimSpace(body)) > 0 && json.Unmarshal(body, &response) == nil && response.Pass != nil {
+		return *response.Pass, nil
+	}
+
+	return true, nil
+}